@@ -0,0 +1,276 @@
+package goplogjson
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/axpira/gop/log"
+)
+
+// FieldBuilder is the log.FieldBuilder of this package with the field
+// types not defined by gop log, use Extend to get it
+type FieldBuilder interface {
+	log.FieldBuilder
+
+	// Ctx adds the fields found in the context to the FieldBuilder
+	Ctx(context.Context) log.FieldBuilder
+
+	// Strs adds the field key with a value as an array of strings to the FieldBuilder
+	Strs(string, []string) log.FieldBuilder
+	// Ints adds the field key with a value as an array of ints to the FieldBuilder
+	Ints(string, []int) log.FieldBuilder
+	// Floats adds the field key with a value as an array of float64 to the FieldBuilder
+	Floats(string, []float64) log.FieldBuilder
+	// Bools adds the field key with a value as an array of bools to the FieldBuilder
+	Bools(string, []bool) log.FieldBuilder
+	// Durs adds the field key with a value as an array of durations to the FieldBuilder
+	Durs(string, []time.Duration) log.FieldBuilder
+	// Times adds the field key with a value as an array of times to the FieldBuilder
+	Times(string, []time.Time) log.FieldBuilder
+	// Errs adds the field key with a value as an array of errors to the FieldBuilder
+	Errs(string, []error) log.FieldBuilder
+	// Array adds the field key with a value as an Array to the FieldBuilder
+	Array(string, *Array) log.FieldBuilder
+}
+
+// Extend returns fb as a FieldBuilder, builders not created by this
+// package are replaced by one that discards every field
+func Extend(fb log.FieldBuilder) FieldBuilder {
+	if f, ok := fb.(FieldBuilder); ok {
+		return f
+	}
+	return emptyFieldPtr
+}
+
+func (f *field) Strs(key string, value []string) log.FieldBuilder {
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = appendString(f.buf, v)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Ints(key string, value []int) log.FieldBuilder {
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = strconv.AppendInt(f.buf, int64(v), 10)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Floats(key string, value []float64) log.FieldBuilder {
+	policy := f.cfg.floatPolicy()
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = appendFloat(f.buf, v, 64, policy)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+// floats32 adds the field key with value, used by Interface as the
+// FieldBuilder has no method for []float32
+func (f *field) floats32(key string, value []float32) log.FieldBuilder {
+	policy := f.cfg.floatPolicy()
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = appendFloat(f.buf, float64(v), 32, policy)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Bools(key string, value []bool) log.FieldBuilder {
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = strconv.AppendBool(f.buf, v)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Durs(key string, value []time.Duration) log.FieldBuilder {
+	unit := f.cfg.durationFieldUnit()
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = strconv.AppendInt(f.buf, int64(v/unit), 10)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Times(key string, value []time.Time) log.FieldBuilder {
+	format := f.cfg.timeFormat()
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		f.buf = append(f.buf, '"')
+		f.buf = v.AppendFormat(f.buf, format)
+		f.buf = append(f.buf, '"')
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Errs(key string, value []error) log.FieldBuilder {
+	f.buf = append(appendKey(f.buf, key), '[')
+	for i, v := range value {
+		if i > 0 {
+			f.buf = append(f.buf, ',')
+		}
+		if v == nil {
+			f.buf = append(f.buf, "null"...)
+			continue
+		}
+		f.appendErrorValue(v)
+	}
+	f.buf = append(f.buf, ']')
+	return f
+}
+
+func (f *field) Array(key string, value *Array) log.FieldBuilder {
+	f.buf = appendKey(f.buf, key)
+	if len(value.buf) == 0 {
+		f.buf = append(f.buf, '[')
+	} else {
+		value.buf[0] = '['
+		f.buf = value.appendTo(f.buf, f.cfg.floatPolicy())
+	}
+	f.buf = append(f.buf, ']')
+	putArray(value)
+	return f
+}
+
+// Array is an array of values of any type, including dictionaries.
+// It's created by Arr and returned to a pool when added to a FieldBuilder
+type Array struct {
+	buf []byte
+	// nonFinite has the offsets in buf of the NaN and ±Inf values, they
+	// are encoded with the policy of the logger the Array is added to
+	nonFinite []int
+}
+
+// appendTo appends buf to dst with the non-finite floats encoded
+// according to policy
+func (a *Array) appendTo(dst []byte, policy FloatPolicy) []byte {
+	if policy == FloatString || len(a.nonFinite) == 0 {
+		return append(dst, a.buf...)
+	}
+	last := 0
+	for _, at := range a.nonFinite {
+		dst = append(dst, a.buf[last:at]...)
+		dst = appendFloat(dst, math.NaN(), 64, policy)
+		// skip the quoted "NaN", "+Inf" or "-Inf"
+		last = at + 1 + bytes.IndexByte(a.buf[at+1:], '"') + 1
+	}
+	return append(dst, a.buf[last:]...)
+}
+
+var arrayPool = &sync.Pool{
+	New: func() interface{} {
+		return &Array{
+			buf: make([]byte, 0, 500),
+		}
+	},
+}
+
+// Arr returns a new empty Array
+func Arr() *Array {
+	a := arrayPool.Get().(*Array)
+	a.buf = a.buf[:0]
+	a.nonFinite = a.nonFinite[:0]
+	return a
+}
+
+func putArray(a *Array) {
+	// see putField
+	const maxSize = 1 << 16 // 64KiB
+	if cap(a.buf) > maxSize {
+		return
+	}
+	arrayPool.Put(a)
+}
+
+// Str adds a string to the Array
+func (a *Array) Str(value string) *Array {
+	a.buf = appendString(append(a.buf, ','), value)
+	return a
+}
+
+// Int adds an int to the Array
+func (a *Array) Int(value int) *Array {
+	return a.Int64(int64(value))
+}
+
+// Int64 adds an int64 to the Array
+func (a *Array) Int64(value int64) *Array {
+	a.buf = strconv.AppendInt(append(a.buf, ','), value, 10)
+	return a
+}
+
+// Uint64 adds an uint64 to the Array
+func (a *Array) Uint64(value uint64) *Array {
+	a.buf = strconv.AppendUint(append(a.buf, ','), value, 10)
+	return a
+}
+
+// Float64 adds a float64 to the Array, NaN and ±Inf are encoded according
+// to the NonFiniteFloatPolicy of the logger the Array is added to, with
+// FloatOmit encoded as null
+func (a *Array) Float64(value float64) *Array {
+	a.buf = append(a.buf, ',')
+	if !isFinite(value) {
+		a.nonFinite = append(a.nonFinite, len(a.buf))
+	}
+	a.buf = appendFloat(a.buf, value, 64, FloatString)
+	return a
+}
+
+// Bool adds a bool to the Array
+func (a *Array) Bool(value bool) *Array {
+	a.buf = strconv.AppendBool(append(a.buf, ','), value)
+	return a
+}
+
+// Dict adds a dictionary with the fields of fb to the Array
+func (a *Array) Dict(fb log.FieldBuilder) *Array {
+	fi, ok := fb.(*field)
+	if !ok {
+		return a
+	}
+	if len(fi.buf) == 0 {
+		a.buf = append(a.buf, ',', '{')
+	} else {
+		fi.buf[0] = '{'
+		a.buf = append(append(a.buf, ','), fi.buf...)
+	}
+	a.buf = append(a.buf, '}')
+	fi.discard()
+	return a
+}
@@ -0,0 +1,47 @@
+package goplogjson
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerArrays(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out))
+	ts := time.Date(2021, 9, 26, 7, 57, 36, 0, time.UTC)
+	fb := Extend(l.NewFieldBuilder())
+	fb.Strs("strs", []string{"a", `"b"`})
+	fb.Ints("ints", []int{1, -2})
+	fb.Floats("floats", []float64{1.5, 2})
+	fb.Bools("bools", []bool{true, false})
+	fb.Durs("durs", []time.Duration{time.Second, 2 * time.Millisecond})
+	fb.Times("times", []time.Time{ts})
+	fb.Errs("errs", []error{errors.New("first"), nil})
+	fb.Strs("empty", nil)
+	fb.Array("arr", Arr().Str("a").Int(1).Bool(true).Dict(l.NewFieldBuilder().Str("k", "v")))
+	fb.Array("emptyArr", Arr())
+	fb.Interface("iface", []string{"x"})
+	l.Inf(fb.Msg("test"))
+
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+		"strs":["a","\"b\""], "ints":[1,-2], "floats":[1.5,2], "bools":[true,false],
+		"durs":[1000,2], "times":["2021-09-26T07:57:36Z"], "errs":["first",null],
+		"empty":[], "arr":["a",1,true,{"k":"v"}], "emptyArr":[], "iface":["x"]}`
+	got, gotErr := stringToMap(out.String())
+	wantMap, wantErr := stringToMap(want)
+	if gotErr != nil || wantErr != nil {
+		t.Fatalf("invalid json: %v %v\n%s", gotErr, wantErr, out.String())
+	}
+	if fmt.Sprint(wantMap) != fmt.Sprint(got) {
+		t.Errorf("want %v and got %v", wantMap, got)
+	}
+}
+
+func TestExtendForeignBuilder(t *testing.T) {
+	if fb := Extend(emptyFieldPtr); fb != emptyFieldPtr {
+		t.Errorf("want empty field and got %v", fb)
+	}
+}
@@ -0,0 +1,199 @@
+package goplogjson
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/axpira/gop/log"
+)
+
+// AsyncPolicy defines what an AsyncWriter does when its queue is full
+type AsyncPolicy uint8
+
+const (
+	// AsyncBlock waits until there is room in the queue
+	AsyncBlock AsyncPolicy = iota
+	// AsyncDropNewest discards the line being written
+	AsyncDropNewest
+	// AsyncDropOldest discards the oldest line in the queue
+	AsyncDropOldest
+	// AsyncDropBelowLevel discards the line being written when its level is
+	// below AsyncConfig.MinLevel, otherwise waits until there is room in the queue
+	AsyncDropBelowLevel
+)
+
+// DefaultAsyncSize is the number of lines queued when AsyncConfig.Size is not set
+const DefaultAsyncSize = 1024
+
+// ErrAsyncClosed is returned when writing to a closed AsyncWriter
+var ErrAsyncClosed = errors.New("goplogjson: async writer is closed")
+
+// AsyncConfig defines the queue of an AsyncWriter
+type AsyncConfig struct {
+	// Size is the max number of lines waiting to be written
+	Size int
+	// Policy defines what to do when the queue is full
+	Policy AsyncPolicy
+	// MinLevel is the lowest level kept by AsyncDropBelowLevel when the queue is full
+	MinLevel log.Level
+	// ErrorHandler is called when the underlying writer fails, the logger
+	// never sees these errors because the line was already queued
+	ErrorHandler func(error)
+}
+
+type asyncEntry struct {
+	lv  log.Level
+	buf []byte
+}
+
+// AsyncWriter writes lines to another io.Writer from a background goroutine.
+// Lines are copied to a bounded ring buffer, so Write never waits for the
+// underlying writer unless the queue is full and the policy is to block
+type AsyncWriter struct {
+	dropped uint64
+
+	out     io.Writer
+	policy  AsyncPolicy
+	minLvl  log.Level
+	onError func(error)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []asyncEntry
+	head    int
+	count   int
+	writing bool
+	closed  bool
+	done    chan struct{}
+}
+
+// NewAsyncWriter creates an AsyncWriter writing to out and starts its goroutine
+func NewAsyncWriter(out io.Writer, cfg AsyncConfig) *AsyncWriter {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultAsyncSize
+	}
+	w := &AsyncWriter{
+		out:     out,
+		policy:  cfg.Policy,
+		minLvl:  cfg.MinLevel,
+		onError: cfg.ErrorHandler,
+		queue:   make([]asyncEntry, cfg.Size),
+		done:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// WithAsync replaces the output of the logger with an AsyncWriter
+// wrapping it, so it must be used after WithOutput
+func WithAsync(cfg AsyncConfig) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.out = NewAsyncWriter(l1.out, cfg)
+		return l1
+	})
+}
+
+// Write queues p with NoLevel
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(log.NoLevel, p)
+}
+
+// WriteLevel queues a copy of p, applying the policy when the queue is full
+func (w *AsyncWriter) WriteLevel(lv log.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.count == len(w.queue) && !w.closed {
+		switch {
+		case w.policy == AsyncDropNewest,
+			w.policy == AsyncDropBelowLevel && lv < w.minLvl:
+			atomic.AddUint64(&w.dropped, 1)
+			return len(p), nil
+		case w.policy == AsyncDropOldest:
+			w.head = (w.head + 1) % len(w.queue)
+			w.count--
+			atomic.AddUint64(&w.dropped, 1)
+		default:
+			w.cond.Wait()
+		}
+	}
+	if w.closed {
+		return 0, ErrAsyncClosed
+	}
+	e := &w.queue[(w.head+w.count)%len(w.queue)]
+	e.lv = lv
+	e.buf = append(e.buf[:0], p...)
+	w.count++
+	w.cond.Broadcast()
+	return len(p), nil
+}
+
+// Dropped returns the number of lines discarded because the queue was full
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Flush waits until every queued line is written and flushes the underlying writer
+func (w *AsyncWriter) Flush() error {
+	w.mu.Lock()
+	for w.count > 0 || w.writing {
+		w.cond.Wait()
+	}
+	w.mu.Unlock()
+	return syncWriter(w.out)
+}
+
+// Close writes the queued lines, stops the goroutine and closes the
+// underlying writer
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	closed := w.closed
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+	if closed {
+		return nil
+	}
+	return closeWriter(w.out)
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	var spare []byte
+	w.mu.Lock()
+	for {
+		for w.count == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.count == 0 {
+			w.mu.Unlock()
+			return
+		}
+		// the buffer of the entry is swapped with spare, so the entry can be
+		// reused by WriteLevel while this one is being written
+		e := &w.queue[w.head]
+		lv, buf := e.lv, e.buf
+		e.buf = spare
+		w.head = (w.head + 1) % len(w.queue)
+		w.count--
+		w.writing = true
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		if _, err := writeLevel(w.out, lv, buf); err != nil {
+			countFailedWrite()
+			if w.onError != nil {
+				w.onError(err)
+			}
+		}
+		spare = buf[:0]
+
+		w.mu.Lock()
+		w.writing = false
+		w.cond.Broadcast()
+	}
+}
@@ -0,0 +1,108 @@
+package goplogjson
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/axpira/gop/log"
+)
+
+// blockingWriter holds every Write until release is closed
+type blockingWriter struct {
+	mu      sync.Mutex
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	lines   []string
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.release
+	w.mu.Lock()
+	w.lines = append(w.lines, string(p))
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithAsync(AsyncConfig{Size: 2}))
+	for i := 0; i < 100; i++ {
+		l.Infof("line %d", i)
+	}
+	w := l.(*logger).out.(*AsyncWriter)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("want 100 lines and got %d", len(lines))
+	}
+	for i, line := range lines {
+		want := fmt.Sprintf(`{"level":"info", "msg":"line %d", "time":"2021-09-26T07:57:36Z"}`, i)
+		if diff := compareJson(want, line); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+	if w.Dropped() != 0 {
+		t.Errorf("want no dropped lines and got %d", w.Dropped())
+	}
+	if _, err := w.Write([]byte("after close")); err != ErrAsyncClosed {
+		t.Errorf("want %v and got %v", ErrAsyncClosed, err)
+	}
+}
+
+func TestAsyncWriterDropPolicy(t *testing.T) {
+	tests := map[string]struct {
+		cfg         AsyncConfig
+		levels      []log.Level
+		wantLines   []string
+		wantDropped uint64
+	}{
+		"drop newest": {
+			cfg:         AsyncConfig{Size: 2, Policy: AsyncDropNewest},
+			levels:      []log.Level{log.InfoLevel, log.InfoLevel, log.InfoLevel, log.InfoLevel},
+			wantLines:   []string{"first", "1", "2"},
+			wantDropped: 2,
+		},
+		"drop oldest": {
+			cfg:         AsyncConfig{Size: 2, Policy: AsyncDropOldest},
+			levels:      []log.Level{log.InfoLevel, log.InfoLevel, log.InfoLevel, log.InfoLevel},
+			wantLines:   []string{"first", "3", "4"},
+			wantDropped: 2,
+		},
+		"drop below level": {
+			cfg:         AsyncConfig{Size: 2, Policy: AsyncDropBelowLevel, MinLevel: log.WarnLevel},
+			levels:      []log.Level{log.WarnLevel, log.InfoLevel, log.DebugLevel},
+			wantLines:   []string{"first", "1", "2"},
+			wantDropped: 1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := newBlockingWriter()
+			w := NewAsyncWriter(out, tc.cfg)
+			w.Write([]byte("first"))
+			<-out.started
+			for i, lv := range tc.levels {
+				w.WriteLevel(lv, []byte(fmt.Sprint(i+1)))
+			}
+			close(out.release)
+			w.Flush()
+			if fmt.Sprint(out.lines) != fmt.Sprint(tc.wantLines) {
+				t.Errorf("want lines %v and got %v", tc.wantLines, out.lines)
+			}
+			if w.Dropped() != tc.wantDropped {
+				t.Errorf("want %d dropped lines and got %d", tc.wantDropped, w.Dropped())
+			}
+			w.Close()
+		})
+	}
+}
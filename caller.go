@@ -0,0 +1,98 @@
+package goplogjson
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/axpira/gop/log"
+)
+
+var (
+	// loggerFuncPrefixes are the functions skipped to find the caller:
+	// the methods of the logger and slog handler, the helpers of gop log,
+	// the standard log and slog
+	loggerFuncPrefixes = []string{
+		reflect.TypeOf(logger{}).PkgPath() + ".(*logger).",
+		reflect.TypeOf(logger{}).PkgPath() + ".(*slogHandler).",
+		reflect.TypeOf(log.LoggerOptionFunc(nil)).PkgPath() + ".",
+		"log.",
+		"log/slog.",
+	}
+)
+
+// FullCaller formats the caller as the full path of the file and the line
+func FullCaller(file string, line int) string {
+	return file + ":" + strconv.Itoa(line)
+}
+
+// ShortCaller formats the caller as the name of the file and the line
+func ShortCaller(file string, line int) string {
+	if i := strings.LastIndexByte(file, '/'); i >= 0 {
+		file = file[i+1:]
+	}
+	return FullCaller(file, line)
+}
+
+// PackageCaller formats the caller as the directory of the file, usually
+// the package, the name of the file and the line
+func PackageCaller(file string, line int) string {
+	if i := strings.LastIndexByte(file, '/'); i > 0 {
+		if j := strings.LastIndexByte(file[:i], '/'); j >= 0 {
+			file = file[j+1:]
+		}
+	}
+	return FullCaller(file, line)
+}
+
+// WithCaller adds the caller field with the file and line that called the
+// logger, skipping skip more frames so helpers wrapping the logger can
+// report the call site of their callers
+func WithCaller(skip int) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.caller = true
+		l1.callerSkip = skip
+		return l1
+	})
+}
+
+func isLoggerFunc(name string) bool {
+	for _, prefix := range loggerFuncPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerFrame returns the first frame outside of the logger, skipping
+// skip more frames
+func callerFrame(skip int) (runtime.Frame, bool) {
+	var pcs [32]uintptr
+	// skip runtime.Callers and callerFrame
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isLoggerFunc(frame.Function) {
+			if skip == 0 {
+				return frame, true
+			}
+			skip--
+		}
+		if !more {
+			return frame, false
+		}
+	}
+}
+
+// appendCaller adds the caller field and, when it has a name, the
+// function field
+func (f *field) appendCaller(frame runtime.Frame) {
+	f.Str(f.cfg.callerFieldName(), f.cfg.callerFormat(frame.File, frame.Line))
+	if name := f.cfg.callerFuncFieldName(); name != "" {
+		f.Str(name, frame.Function)
+	}
+}
@@ -0,0 +1,298 @@
+package goplogjson
+
+import (
+	"time"
+
+	"github.com/axpira/gop/log"
+)
+
+// EncoderConfig defines how a logger encodes its fields.
+// A logger without an EncoderConfig uses the package level variables,
+// so changing them still affects every logger created without WithEncoderConfig.
+// WithEncoderConfig fills the empty names, the nil funcs, a zero
+// DurationFieldUnit and TraceFormat from DefaultEncoderConfig, as their zero
+// value is not a valid setting. The bools and the policies are used as they
+// are, so a config always wins over the package level variables
+type EncoderConfig struct {
+	// LevelFieldName defines the key name for Level field
+	LevelFieldName string
+	// MessageFieldName defines the key name for Message field
+	MessageFieldName string
+	// ErrorFieldName defines the key name for Error field
+	ErrorFieldName string
+	// TimestampFieldName defines the key name for Timestamp field
+	TimestampFieldName string
+	// CallerFieldName defines the key name for Caller field
+	CallerFieldName string
+	// CallerFuncFieldName defines the key name for the function of the
+	// caller, when it's empty the function is not logged
+	CallerFuncFieldName string
+	// CallerFormatter formats the file and line of the Caller field
+	CallerFormatter func(file string, line int) string
+	// StackFieldName defines the key name for Stack field
+	StackFieldName string
+	// ErrorChainEnabled logs errors as an array with an object, with msg
+	// and type, for each error of the chain. Errors implementing
+	// log.LogMarshaler add their fields to the object
+	ErrorChainEnabled bool
+	// NonFiniteFloatPolicy defines how NaN and ±Inf values are encoded
+	NonFiniteFloatPolicy FloatPolicy
+	// DuplicateKeyPolicy defines what is done with repeated keys, the
+	// level, msg, time and err fields written by the logger always win
+	DuplicateKeyPolicy DedupPolicy
+	// ReservedFirst writes the time, level and msg fields first, in this
+	// order, and sorts the keys of Fields
+	ReservedFirst bool
+	// TraceFormat defines the trace fields added by Ctx
+	TraceFormat TraceFormat
+
+	// TimestampDisabled omits the timestamp field of each line
+	TimestampDisabled bool
+	// TimestampFunc returns the time used in the timestamp field
+	TimestampFunc func() time.Time
+	// TimestampFormat defines the layout of the timestamp field
+	TimestampFormat string
+	// TimeFormat defines the layout for time.Time type fields added
+	// using the Time method
+	TimeFormat string
+	// DurationFieldUnit defines the unit for time.Duration type fields added
+	// using the Dur method.
+	DurationFieldUnit time.Duration
+
+	// LevelNameFunc returns the value of the level field
+	LevelNameFunc func(log.Level) string
+}
+
+// DefaultEncoderConfig returns an EncoderConfig filled with the current
+// values of the package level variables
+func DefaultEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		LevelFieldName:       LevelFieldName,
+		MessageFieldName:     MessageFieldName,
+		ErrorFieldName:       ErrorFieldName,
+		TimestampFieldName:   TimestampFieldName,
+		CallerFieldName:      CallerFieldName,
+		CallerFuncFieldName:  CallerFuncFieldName,
+		CallerFormatter:      CallerFormatter,
+		StackFieldName:       StackFieldName,
+		ErrorChainEnabled:    ErrorChainEnabled,
+		NonFiniteFloatPolicy: NonFiniteFloatPolicy,
+		DuplicateKeyPolicy:   DuplicateKeyPolicy,
+		ReservedFirst:        ReservedFirst,
+		TraceFormat:          DefaultTraceFormat,
+		TimestampDisabled:    !TimestampEnabled,
+		TimestampFunc:        TimestampFunc,
+		TimestampFormat:      TimestampFormat,
+		TimeFormat:           TimeFormat,
+		DurationFieldUnit:    DurationFieldUnit,
+		LevelNameFunc:        LevelNameFunc,
+	}
+}
+
+// WithEncoderConfig sets the EncoderConfig used by the logger and every
+// logger derived from it
+func WithEncoderConfig(cfg EncoderConfig) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		cfg.fill(DefaultEncoderConfig())
+		l1.cfg = &cfg
+		return l1
+	})
+}
+
+// fill sets the zero fields of c, that are not a valid setting, with the
+// ones of def
+func (c *EncoderConfig) fill(def EncoderConfig) {
+	if c.LevelFieldName == "" {
+		c.LevelFieldName = def.LevelFieldName
+	}
+	if c.MessageFieldName == "" {
+		c.MessageFieldName = def.MessageFieldName
+	}
+	if c.ErrorFieldName == "" {
+		c.ErrorFieldName = def.ErrorFieldName
+	}
+	if c.TimestampFieldName == "" {
+		c.TimestampFieldName = def.TimestampFieldName
+	}
+	if c.CallerFieldName == "" {
+		c.CallerFieldName = def.CallerFieldName
+	}
+	if c.CallerFuncFieldName == "" {
+		c.CallerFuncFieldName = def.CallerFuncFieldName
+	}
+	if c.CallerFormatter == nil {
+		c.CallerFormatter = def.CallerFormatter
+	}
+	if c.StackFieldName == "" {
+		c.StackFieldName = def.StackFieldName
+	}
+	if c.TraceFormat.TraceIDFieldName == "" {
+		c.TraceFormat = def.TraceFormat
+	}
+	if c.TimestampFunc == nil {
+		c.TimestampFunc = def.TimestampFunc
+	}
+	if c.TimestampFormat == "" {
+		c.TimestampFormat = def.TimestampFormat
+	}
+	if c.TimeFormat == "" {
+		c.TimeFormat = def.TimeFormat
+	}
+	if c.DurationFieldUnit == 0 {
+		c.DurationFieldUnit = def.DurationFieldUnit
+	}
+	if c.LevelNameFunc == nil {
+		c.LevelNameFunc = def.LevelNameFunc
+	}
+}
+
+// config returns a copy of the EncoderConfig of the logger, to be changed
+// by the options. A logger without one gets the config of
+// WithEncoderConfig(EncoderConfig{}), so the option is the only setting
+// that differs from the defaults
+func (l *logger) config() EncoderConfig {
+	if l.cfg != nil {
+		return *l.cfg
+	}
+	var cfg EncoderConfig
+	cfg.fill(DefaultEncoderConfig())
+	return cfg
+}
+
+// The accessors below are safe to call with a nil *EncoderConfig,
+// in that case the package level variables are used. A config set by
+// WithEncoderConfig has no zero fields, see fill
+
+func (c *EncoderConfig) levelFieldName() string {
+	if c == nil {
+		return LevelFieldName
+	}
+	return c.LevelFieldName
+}
+
+func (c *EncoderConfig) messageFieldName() string {
+	if c == nil {
+		return MessageFieldName
+	}
+	return c.MessageFieldName
+}
+
+func (c *EncoderConfig) errorFieldName() string {
+	if c == nil {
+		return ErrorFieldName
+	}
+	return c.ErrorFieldName
+}
+
+func (c *EncoderConfig) timestampFieldName() string {
+	if c == nil {
+		return TimestampFieldName
+	}
+	return c.TimestampFieldName
+}
+
+func (c *EncoderConfig) callerFieldName() string {
+	if c == nil {
+		return CallerFieldName
+	}
+	return c.CallerFieldName
+}
+
+func (c *EncoderConfig) callerFuncFieldName() string {
+	if c == nil {
+		return CallerFuncFieldName
+	}
+	return c.CallerFuncFieldName
+}
+
+func (c *EncoderConfig) callerFormat(file string, line int) string {
+	if c == nil {
+		return CallerFormatter(file, line)
+	}
+	return c.CallerFormatter(file, line)
+}
+
+func (c *EncoderConfig) stackFieldName() string {
+	if c == nil {
+		return StackFieldName
+	}
+	return c.StackFieldName
+}
+
+func (c *EncoderConfig) errorChainEnabled() bool {
+	if c == nil {
+		return ErrorChainEnabled
+	}
+	return c.ErrorChainEnabled
+}
+
+func (c *EncoderConfig) floatPolicy() FloatPolicy {
+	if c == nil {
+		return NonFiniteFloatPolicy
+	}
+	return c.NonFiniteFloatPolicy
+}
+
+func (c *EncoderConfig) dedupPolicy() DedupPolicy {
+	if c == nil {
+		return DuplicateKeyPolicy
+	}
+	return c.DuplicateKeyPolicy
+}
+
+func (c *EncoderConfig) reservedFirst() bool {
+	if c == nil {
+		return ReservedFirst
+	}
+	return c.ReservedFirst
+}
+
+func (c *EncoderConfig) traceFormat() TraceFormat {
+	if c == nil {
+		return DefaultTraceFormat
+	}
+	return c.TraceFormat
+}
+
+func (c *EncoderConfig) timestampEnabled() bool {
+	if c == nil {
+		return TimestampEnabled
+	}
+	return !c.TimestampDisabled
+}
+
+func (c *EncoderConfig) timestamp() time.Time {
+	if c == nil {
+		return TimestampFunc()
+	}
+	return c.TimestampFunc()
+}
+
+func (c *EncoderConfig) timestampFormat() string {
+	if c == nil {
+		return TimestampFormat
+	}
+	return c.TimestampFormat
+}
+
+func (c *EncoderConfig) timeFormat() string {
+	if c == nil {
+		return TimeFormat
+	}
+	return c.TimeFormat
+}
+
+func (c *EncoderConfig) durationFieldUnit() time.Duration {
+	if c == nil {
+		return DurationFieldUnit
+	}
+	return c.DurationFieldUnit
+}
+
+func (c *EncoderConfig) levelName(lv log.Level) string {
+	if c == nil {
+		return LevelNameFunc(lv)
+	}
+	return c.LevelNameFunc(lv)
+}
@@ -0,0 +1,76 @@
+package goplogjson
+
+import (
+	"github.com/axpira/gop/log"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorPurple = "\x1b[35m"
+	colorCyan   = "\x1b[36m"
+	colorGray   = "\x1b[90m"
+)
+
+func consoleLevel(lv log.Level) (string, string) {
+	switch lv {
+	case log.TraceLevel:
+		return "TRC", colorPurple
+	case log.DebugLevel:
+		return "DBG", colorBlue
+	case log.InfoLevel:
+		return "INF", colorGreen
+	case log.WarnLevel:
+		return "WRN", colorYellow
+	case log.ErrorLevel:
+		return "ERR", colorRed
+	case log.FatalLevel:
+		return "FTL", colorRed
+	case log.PanicLevel:
+		return "PNC", colorRed
+	}
+	return "???", colorBold
+}
+
+// appendConsole converts the JSON object line to the console format:
+// time, level and message first, then the other fields as key=value
+func appendConsole(dst, line []byte, cfg *EncoderConfig, lv log.Level, color bool) []byte {
+	var ts, msg []byte
+	for key, value, rest, ok := nextField(line); ok; key, value, rest, ok = nextField(rest) {
+		switch {
+		case keyIs(key, cfg.timestampFieldName()):
+			ts = value
+		case keyIs(key, cfg.messageFieldName()):
+			msg = value
+		}
+	}
+	if ts != nil {
+		if color {
+			dst = append(dst, colorGray...)
+		}
+		dst = appendUnquoted(dst, ts)
+		if color {
+			dst = append(dst, colorReset...)
+		}
+		dst = append(dst, ' ')
+	}
+	name, code := consoleLevel(lv)
+	if color {
+		dst = append(dst, code...)
+		dst = append(dst, name...)
+		dst = append(dst, colorReset...)
+	} else {
+		dst = append(dst, name...)
+	}
+	if msg != nil {
+		dst = append(dst, ' ')
+		dst = appendUnquoted(dst, msg)
+	}
+	var arr [128]byte
+	dst = appendTextFields(dst, line, arr[:0], cfg, textConsole, color)
+	return append(dst, '\n')
+}
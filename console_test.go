@@ -0,0 +1,57 @@
+package goplogjson
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/axpira/gop/log"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	tests := map[string]struct {
+		color bool
+		want  string
+	}{
+		"without color": {
+			want: "2021-09-26T07:57:36Z WRN hello \"world\" key=value empty=\"\" spaces=\"a b\" int=42 " +
+				"dict.inner=true err=\"failed: x\" app=test\n",
+		},
+		"with color": {
+			color: true,
+			want: "\x1b[90m2021-09-26T07:57:36Z\x1b[0m \x1b[33mWRN\x1b[0m hello \"world\" " +
+				"\x1b[36mkey=\x1b[0mvalue \x1b[36mempty=\x1b[0m\"\" \x1b[36mspaces=\x1b[0m\"a b\" " +
+				"\x1b[36mint=\x1b[0m42 \x1b[36mdict.inner=\x1b[0mtrue " +
+				"\x1b[36merr=\x1b[0m\x1b[31m\"failed: x\"\x1b[0m \x1b[36mapp=\x1b[0mtest\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := new(strings.Builder)
+			l := New(WithOutput(out), WithFormat(FormatConsole), WithColor(tc.color))
+			l = l.With(l.NewFieldBuilder().Str("app", "test"))
+			l.Log(log.WarnLevel, l.NewFieldBuilder().
+				Msg(`hello "world"`).
+				Str("key", "value").
+				Str("empty", "").
+				Str("spaces", "a b").
+				Int("int", 42).
+				Dict("dict", l.NewFieldBuilder().Bool("inner", true)).
+				Err(errors.New("failed: x")),
+			)
+			if got := out.String(); got != tc.want {
+				t.Errorf("want %q and got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestConsoleColorForced(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithColor(true), WithFormat(FormatConsole), WithOutput(out))
+	l.Info("test")
+	want := "\x1b[90m2021-09-26T07:57:36Z\x1b[0m \x1b[32mINF\x1b[0m test\n"
+	if got := out.String(); got != want {
+		t.Errorf("want %q and got %q", want, got)
+	}
+}
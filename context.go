@@ -0,0 +1,99 @@
+package goplogjson
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/axpira/gop/log"
+)
+
+// ContextExtractor adds to fb the fields found in ctx, it's called by
+// Ctx when registered with RegisterContextExtractor
+type ContextExtractor func(ctx context.Context, fb log.FieldBuilder)
+
+// registeredExtractor gives each registered ContextExtractor an
+// identity, so it can be unregistered
+type registeredExtractor struct {
+	fn ContextExtractor
+}
+
+// extractors holds the []*registeredExtractor, it's replaced on each
+// register and unregister so Ctx reads it without locking
+var extractors = struct {
+	sync.Mutex
+	v atomic.Value
+}{}
+
+// RegisterContextExtractor adds fn to the functions called by Ctx.
+// The returned function unregisters it
+func RegisterContextExtractor(fn ContextExtractor) (unregister func()) {
+	e := &registeredExtractor{fn: fn}
+	extractors.Lock()
+	defer extractors.Unlock()
+	old := contextExtractors()
+	fns := make([]*registeredExtractor, len(old), len(old)+1)
+	copy(fns, old)
+	extractors.v.Store(append(fns, e))
+	return func() { unregisterContextExtractor(e) }
+}
+
+func unregisterContextExtractor(e *registeredExtractor) {
+	extractors.Lock()
+	defer extractors.Unlock()
+	old := contextExtractors()
+	fns := make([]*registeredExtractor, 0, len(old))
+	for _, o := range old {
+		if o != e {
+			fns = append(fns, o)
+		}
+	}
+	extractors.v.Store(fns)
+}
+
+func contextExtractors() []*registeredExtractor {
+	fns, _ := extractors.v.Load().([]*registeredExtractor)
+	return fns
+}
+
+// ContextValue returns a ContextExtractor adding the field key with the
+// value of ctxKey in the context, when it's present
+func ContextValue(key string, ctxKey interface{}) ContextExtractor {
+	return func(ctx context.Context, fb log.FieldBuilder) {
+		if v := ctx.Value(ctxKey); v != nil {
+			fb.Interface(key, v)
+		}
+	}
+}
+
+type fieldsContextKey struct{}
+
+// ContextWithFields returns a copy of ctx with the fields of fb, added
+// to the ones already in ctx. They are added to the line by Ctx
+func ContextWithFields(ctx context.Context, fb log.FieldBuilder) context.Context {
+	fi, ok := fb.(*field)
+	if !ok {
+		return ctx
+	}
+	old, _ := ctx.Value(fieldsContextKey{}).([]byte)
+	buf := make([]byte, 0, len(old)+len(fi.buf))
+	buf = append(append(buf, old...), fi.buf...)
+	fi.discard()
+	return context.WithValue(ctx, fieldsContextKey{}, buf)
+}
+
+func (f *field) Ctx(ctx context.Context) log.FieldBuilder {
+	if ctx == nil {
+		return f
+	}
+	if buf, ok := ctx.Value(fieldsContextKey{}).([]byte); ok {
+		f.buf = append(f.buf, buf...)
+	}
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		f.appendTrace(sc)
+	}
+	for _, e := range contextExtractors() {
+		e.fn(ctx, f)
+	}
+	return f
+}
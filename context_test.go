@@ -0,0 +1,56 @@
+package goplogjson
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type requestIDKey struct{}
+
+func TestFieldCtx(t *testing.T) {
+	t.Cleanup(RegisterContextExtractor(ContextValue("request_id", requestIDKey{})))
+
+	out := new(strings.Builder)
+	l := New(WithOutput(out))
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc")
+	ctx = ContextWithFields(ctx, l.NewFieldBuilder().Str("tenant", "t1"))
+	ctx = ContextWithFields(ctx, l.NewFieldBuilder().Int("user", 42))
+	l.Inf(Extend(l.NewFieldBuilder()).Ctx(ctx).Msg("test"))
+
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+		"request_id":"abc", "tenant":"t1", "user":42}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestFieldCtxEmpty(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out))
+	var nilCtx context.Context
+	fb := Extend(l.NewFieldBuilder())
+	fb.Ctx(nilCtx)
+	l.Inf(fb.Ctx(context.Background()).Msg("test"))
+
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestUnregisterContextExtractor(t *testing.T) {
+	unregister := RegisterContextExtractor(ContextValue("request_id", requestIDKey{}))
+	unregister()
+	unregister()
+
+	out := new(strings.Builder)
+	l := New(WithOutput(out))
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc")
+	l.Inf(Extend(l.NewFieldBuilder()).Ctx(ctx).Msg("test"))
+
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
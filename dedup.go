@@ -0,0 +1,166 @@
+package goplogjson
+
+import (
+	"strconv"
+
+	"github.com/axpira/gop/log"
+)
+
+// DedupPolicy defines what is done with a key found more than once in
+// the top level object of a line
+type DedupPolicy uint8
+
+const (
+	// DedupOff writes every field, even when the key is repeated
+	DedupOff DedupPolicy = iota
+	// DedupKeepFirst keeps the first field with the key
+	DedupKeepFirst
+	// DedupKeepLast keeps the last field with the key
+	DedupKeepLast
+	// DedupRename keeps the first field with the key and renames the
+	// others adding the suffix _1, _2 and so on
+	DedupRename
+)
+
+// WithDedup sets the policy for repeated keys, see
+// EncoderConfig.DuplicateKeyPolicy
+func WithDedup(policy DedupPolicy) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		cfg := l1.config()
+		cfg.DuplicateKeyPolicy = policy
+		l1.cfg = &cfg
+		return l1
+	})
+}
+
+// segment is a top level field of a line, key is the raw key with quotes
+// and the field is buf[start:end], including the ',' before it
+type segment struct {
+	key        []byte
+	start, end int
+	// conflict is set when the field is dropped or renamed,
+	// reserved is the index, plus one, of the reserved field and
+	// written is set when the field was written out of order
+	conflict bool
+	reserved int
+	written  bool
+}
+
+// reservedKeys is the number of the reserved fields tracked by field,
+// they are level, msg, time and err
+const reservedKeys = 4
+
+// reservedNames returns the names of the reserved fields in the same
+// order of field.reservedAt
+func (c *EncoderConfig) reservedNames() [reservedKeys]string {
+	return [reservedKeys]string{
+		c.levelFieldName(),
+		c.messageFieldName(),
+		c.timestampFieldName(),
+		c.errorFieldName(),
+	}
+}
+
+const (
+	reservedLevel = iota
+	reservedMsg
+	reservedTime
+	reservedErr
+)
+
+// markReserved records that the field written next is the reserved
+// field i, the one added by the logger or by Msg, Err and the timestamp
+func (f *field) markReserved(i int) {
+	f.reservedAt[i] = len(f.buf) + 1
+}
+
+// markConflicts marks the fields dropped or renamed by policy.
+// Reserved fields written by the logger always win, a field with the
+// same key is a conflict
+func (f *field) markConflicts(segs []segment, policy DedupPolicy) {
+	names := f.cfg.reservedNames()
+	for i := range segs {
+		s := &segs[i]
+		if s.reserved != 0 {
+			continue
+		}
+		for j, at := range f.reservedAt {
+			if at != 0 && keyIs(s.key, names[j]) {
+				s.conflict = true
+			}
+		}
+	}
+	for i := range segs {
+		s := &segs[i]
+		if s.reserved != 0 || s.conflict {
+			continue
+		}
+		for j := range segs {
+			if i == j || segs[j].conflict || string(segs[j].key) != string(s.key) {
+				continue
+			}
+			if segs[j].reserved != 0 || (policy == DedupKeepLast && j > i) ||
+				(policy != DedupKeepLast && j < i) {
+				s.conflict = true
+				break
+			}
+		}
+	}
+}
+
+// appendSegment appends the field s of f.buf to dst, a conflict is
+// dropped or renamed according to policy. seen holds the keys already
+// used, it's created on the first rename
+func (f *field) appendSegment(dst []byte, segs []segment, s *segment, policy DedupPolicy, seen *map[string]struct{}) []byte {
+	if !s.conflict {
+		return append(dst, f.buf[s.start:s.end]...)
+	}
+	if policy != DedupRename {
+		return dst
+	}
+	if *seen == nil {
+		*seen = make(map[string]struct{}, len(segs))
+		for _, s := range segs {
+			(*seen)[string(s.key)] = struct{}{}
+		}
+	}
+	key := s.key[:len(s.key)-1]
+	value := f.buf[s.start+1+len(s.key) : s.end]
+	for n := 1; ; n++ {
+		mark := len(dst)
+		dst = append(dst, ',')
+		dst = append(dst, key...)
+		dst = append(dst, '_')
+		dst = strconv.AppendInt(dst, int64(n), 10)
+		dst = append(dst, '"')
+		if _, ok := (*seen)[string(dst[mark+1:])]; ok {
+			dst = dst[:mark]
+			continue
+		}
+		(*seen)[string(dst[mark+1:])] = struct{}{}
+		break
+	}
+	return append(dst, value...)
+}
+
+// segments appends the top level fields of f.buf to segs
+func (f *field) segments(segs []segment) []segment {
+	rest := f.buf
+	for {
+		key, value, next, ok := nextField(rest)
+		if !ok {
+			return segs
+		}
+		start := len(f.buf) - len(rest)
+		end := start + 1 + len(key) + 1 + len(value)
+		s := segment{key: key, start: start, end: end}
+		for i, at := range f.reservedAt {
+			if at-1 == start {
+				s.reserved = i + 1
+			}
+		}
+		segs = append(segs, s)
+		rest = next
+	}
+}
@@ -0,0 +1,49 @@
+package goplogjson
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLoggerDedup(t *testing.T) {
+	tests := []struct {
+		policy DedupPolicy
+		want   string
+	}{
+		{DedupOff, `{"user":"event","level":"fake","msg":"test","level":"info","msg":"ctx","user":"ctx","user":"ctx2","time":"2021-09-26T07:57:36Z"}`},
+		{DedupKeepFirst, `{"user":"event","msg":"test","level":"info","time":"2021-09-26T07:57:36Z"}`},
+		{DedupKeepLast, `{"msg":"test","level":"info","user":"ctx2","time":"2021-09-26T07:57:36Z"}`},
+		{DedupRename, `{"user":"event","level_1":"fake","msg":"test","level":"info","msg_1":"ctx","user_1":"ctx","user_2":"ctx2","time":"2021-09-26T07:57:36Z"}`},
+	}
+	for _, tt := range tests {
+		out := new(strings.Builder)
+		l := New(WithOutput(out), WithDedup(tt.policy))
+		l = l.With(l.NewFieldBuilder().Str("msg", "ctx").Str("user", "ctx").Str("user", "ctx2"))
+		l.Inf(l.NewFieldBuilder().Str("user", "event").Str("level", "fake").Msg("test"))
+		if got := strings.TrimSuffix(out.String(), "\n"); got != tt.want {
+			t.Errorf("policy %d:\nwant %s\ngot  %s", tt.policy, tt.want, got)
+		}
+	}
+}
+
+func TestLoggerDedupRenameCollision(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithDedup(DedupRename))
+	l.Inf(l.NewFieldBuilder().Str("a", "1").Str("a_1", "2").Str("a", "3"))
+	want := `{"a":"1","a_1":"2","a_2":"3","level":"info","time":"2021-09-26T07:57:36Z"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+}
+
+func TestLoggerDedupWrite(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithDedup(DedupKeepLast))
+	l = l.With(l.NewFieldBuilder().Str("msg", "ctx"))
+	l.(io.Writer).Write([]byte("from write\n"))
+	want := `{"msg":"from write","level":"info","time":"2021-09-26T07:57:36Z"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+}
@@ -0,0 +1,78 @@
+package goplogjson
+
+import (
+	"reflect"
+
+	"github.com/axpira/gop/log"
+)
+
+// WithErrorChain logs errors as an array with an object, with msg and
+// type, for each error of the chain, see EncoderConfig.ErrorChainEnabled
+func WithErrorChain() log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		cfg := l1.config()
+		cfg.ErrorChainEnabled = true
+		l1.cfg = &cfg
+		return l1
+	})
+}
+
+// appendError adds the field key with err
+func (f *field) appendError(key string, err error) {
+	f.buf = appendKey(f.buf, key)
+	f.appendErrorValue(err)
+}
+
+// appendErrorValue appends err as a string or, when the chain is enabled,
+// as the array of the errors it wraps
+func (f *field) appendErrorValue(err error) {
+	if !f.cfg.errorChainEnabled() {
+		f.buf = appendString(f.buf, err.Error())
+		return
+	}
+	f.buf = append(f.buf, '[')
+	f.appendErrorChain(err, true)
+	f.buf = append(f.buf, ']')
+}
+
+// appendErrorChain walks the chain of err depth first, following
+// Unwrap() error and Unwrap() []error
+func (f *field) appendErrorChain(err error, first bool) bool {
+	for err != nil {
+		if !first {
+			f.buf = append(f.buf, ',')
+		}
+		first = false
+		f.appendErrorObject(err)
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				first = f.appendErrorChain(e, first)
+			}
+			return first
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		default:
+			return first
+		}
+	}
+	return first
+}
+
+// appendErrorObject appends the object with the message and the type of
+// err, errors implementing log.LogMarshaler add their fields to it
+func (f *field) appendErrorObject(err error) {
+	f.buf = append(f.buf, `{"msg":`...)
+	f.buf = appendString(f.buf, err.Error())
+	f.buf = append(f.buf, `,"type":`...)
+	f.buf = appendString(f.buf, reflect.TypeOf(err).String())
+	if m, ok := err.(log.LogMarshaler); ok {
+		builder := newField()
+		builder.cfg = f.cfg
+		m.MarshalLog(builder)
+		f.buf = append(f.buf, builder.buf...)
+		builder.discard()
+	}
+	f.buf = append(f.buf, '}')
+}
@@ -0,0 +1,59 @@
+package goplogjson
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/axpira/gop/log"
+)
+
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+type codeError struct {
+	code int
+}
+
+func (e *codeError) Error() string {
+	return fmt.Sprintf("code %d", e.code)
+}
+
+func (e *codeError) MarshalLog(fb log.FieldBuilder) {
+	fb.Int("code", e.code).Str("kind", "domain")
+}
+
+func TestLoggerErrorChain(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithErrorChain())
+
+	err := fmt.Errorf("outer: %w", multiError{errors.New("first"), &codeError{code: 42}})
+	l.Error("test", err)
+
+	want := `{"level":"error", "msg":"test", "time":"2021-09-26T07:57:36Z", "err":[
+		{"msg":"outer: first; code 42", "type":"*fmt.wrapError"},
+		{"msg":"first; code 42", "type":"goplogjson.multiError"},
+		{"msg":"first", "type":"*errors.errorString"},
+		{"msg":"code 42", "type":"*goplogjson.codeError", "code":42, "kind":"domain"}
+	]}`
+	got, gotErr := stringToMap(out.String())
+	wantMap, wantErr := stringToMap(want)
+	if gotErr != nil || wantErr != nil {
+		t.Fatalf("invalid json: %v %v\n%s", gotErr, wantErr, out.String())
+	}
+	if fmt.Sprint(wantMap) != fmt.Sprint(got) {
+		t.Errorf("want %v and got %v", wantMap, got)
+	}
+}
@@ -140,3 +140,36 @@ func (f *emptyField) Update(l log.Logger) log.Logger {
 func (f *emptyField) Level(string) log.FieldBuilder {
 	return f
 }
+
+func (f *emptyField) Strs(string, []string) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Ints(string, []int) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Floats(string, []float64) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Bools(string, []bool) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Durs(string, []time.Duration) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Times(string, []time.Time) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Errs(string, []error) log.FieldBuilder {
+	return f
+}
+
+func (f *emptyField) Array(_ string, a *Array) log.FieldBuilder {
+	putArray(a)
+	return f
+}
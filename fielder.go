@@ -1,12 +1,13 @@
 package goplogjson
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"reflect"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/axpira/gop/log"
@@ -21,6 +22,27 @@ var (
 	ErrorFieldName = "err"
 	// TimestampFieldName defines the key name for Timestamp field
 	TimestampFieldName = "time"
+	// CallerFieldName defines the key name for Caller field
+	CallerFieldName = "caller"
+	// CallerFuncFieldName defines the key name for the function of the
+	// caller, when it's empty the function is not logged
+	CallerFuncFieldName = ""
+	// CallerFormatter formats the file and line of the Caller field
+	CallerFormatter = PackageCaller
+	// StackFieldName defines the key name for Stack field
+	StackFieldName = "stack"
+	// ErrorChainEnabled logs errors as an array with an object, with msg
+	// and type, for each error of the chain
+	ErrorChainEnabled = false
+	// NonFiniteFloatPolicy defines how NaN and ±Inf values are encoded
+	NonFiniteFloatPolicy = FloatString
+	// DuplicateKeyPolicy defines what is done with repeated keys
+	DuplicateKeyPolicy = DedupOff
+	// ReservedFirst writes the time, level and msg fields first and
+	// sorts the keys of Fields
+	ReservedFirst = false
+	// DefaultTraceFormat defines the trace fields added by Ctx
+	DefaultTraceFormat = W3CTraceFormat()
 
 	TimestampEnabled = true
 	TimestampFunc    = time.Now
@@ -57,16 +79,28 @@ var (
 
 type field struct {
 	buf []byte
+	cfg *EncoderConfig
+	// ts replaces the timestamp of the line when it's set,
+	// noTs omits the timestamp
+	ts   time.Time
+	noTs bool
+	// stack enables the stack of errors added with Err, errStack is the
+	// first of them with a stack, hasStack is set when the stack field was
+	// added
+	stack    bool
+	errStack stackTracer
+	hasStack bool
+	// reservedAt is the offset, plus one, of the reserved fields written
+	// by the logger, see markReserved
+	reservedAt [reservedKeys]int
+	// pooled is 1 while the field is in the pool, see putField
+	pooled uint32
 }
 
 func appendKey(buf []byte, key string) []byte {
 	return append(appendString(append(buf, ','), key), ':')
 }
 
-func (f *field) Ctx(ctx context.Context) log.FieldBuilder {
-	return f
-}
-
 func (f *field) Str(key string, value string) log.FieldBuilder {
 	f.buf = appendString(appendKey(f.buf, key), value)
 	return f
@@ -103,17 +137,18 @@ func (f *field) Uint64(key string, value uint64) log.FieldBuilder {
 }
 
 func (f *field) Float32(key string, value float32) log.FieldBuilder {
-	f.buf = strconv.AppendFloat(appendKey(f.buf, key), float64(value), 'f', -1, 32)
+	f.float(key, float64(value), 32)
 	return f
 }
 
 func (f *field) Float64(key string, value float64) log.FieldBuilder {
-	f.buf = strconv.AppendFloat(appendKey(f.buf, key), value, 'f', -1, 64)
+	f.float(key, value, 64)
 	return f
 }
 
 func (f *field) Msg(msg string) log.FieldBuilder {
-	return f.Str(MessageFieldName, msg)
+	f.markReserved(reservedMsg)
+	return f.Str(f.cfg.messageFieldName(), msg)
 }
 
 func (f *field) Marshal(key string, value interface{}) log.FieldBuilder {
@@ -121,6 +156,15 @@ func (f *field) Marshal(key string, value interface{}) log.FieldBuilder {
 		return f.marshalLog(key, obj)
 	}
 	jsonByteArr, err := json.Marshal(value)
+	var unsupported *json.UnsupportedValueError
+	if errors.As(err, &unsupported) && isNonFiniteString(unsupported.Str) {
+		// NaN or ±Inf inside value, encode it again with the float policy
+		v, ok := replaceNonFinite(reflect.ValueOf(value), f.cfg.floatPolicy())
+		if !ok {
+			return f
+		}
+		jsonByteArr, err = json.Marshal(v)
+	}
 	if err != nil {
 		return f.Error(key, err)
 	}
@@ -130,6 +174,7 @@ func (f *field) Marshal(key string, value interface{}) log.FieldBuilder {
 
 func (f *field) marshalLog(key string, value log.LogMarshaler) log.FieldBuilder {
 	builder := newField()
+	builder.cfg = f.cfg
 	value.MarshalLog(builder)
 	return f.Dict(key, builder)
 }
@@ -174,6 +219,24 @@ func (f *field) Interface(key string, value interface{}) log.FieldBuilder {
 		return f.Complex128(key, v)
 	case []byte:
 		return f.Bytes(key, v)
+	case []string:
+		return f.Strs(key, v)
+	case []int:
+		return f.Ints(key, v)
+	case []float32:
+		return f.floats32(key, v)
+	case []float64:
+		return f.Floats(key, v)
+	case []bool:
+		return f.Bools(key, v)
+	case []time.Duration:
+		return f.Durs(key, v)
+	case []time.Time:
+		return f.Times(key, v)
+	case []error:
+		return f.Errs(key, v)
+	case *Array:
+		return f.Array(key, v)
 	case error:
 		return f.Error(key, v)
 	case fmt.Stringer:
@@ -184,6 +247,12 @@ func (f *field) Interface(key string, value interface{}) log.FieldBuilder {
 }
 
 func (f *field) Fields(m map[string]interface{}) log.FieldBuilder {
+	if f.cfg.reservedFirst() {
+		for _, k := range sortedKeys(m) {
+			f.Interface(k, m[k])
+		}
+		return f
+	}
 	for k, v := range m {
 		f.Interface(k, v)
 	}
@@ -195,14 +264,25 @@ func (f *field) Complex64(key string, value complex64) log.FieldBuilder {
 }
 
 func (f *field) Complex128(key string, value complex128) log.FieldBuilder {
+	if policy := f.cfg.floatPolicy(); policy != FloatString &&
+		(!isFinite(real(value)) || !isFinite(imag(value))) {
+		if policy == FloatNull {
+			f.buf = append(appendKey(f.buf, key), "null"...)
+		}
+		return f
+	}
 	return f.Str(key, strconv.FormatComplex(value, 'g', 4, 128))
 }
 
 func (f *field) Dict(key string, fi log.FieldBuilder) log.FieldBuilder {
 	f.buf = appendKey(f.buf, key)
 	fi1 := fi.(*field)
-	fi1.buf[0] = '{'
-	f.buf = append(f.buf, fi1.buf...)
+	if len(fi1.buf) == 0 {
+		f.buf = append(f.buf, '{')
+	} else {
+		fi1.buf[0] = '{'
+		f.buf = append(f.buf, fi1.buf...)
+	}
 	f.buf = append(f.buf, '}')
 	fi1.discard()
 	return f
@@ -252,11 +332,11 @@ func (f *field) Timef(key string, value time.Time, format string) log.FieldBuild
 }
 
 func (f *field) Time(key string, value time.Time) log.FieldBuilder {
-	return f.Timef(key, value, TimeFormat)
+	return f.Timef(key, value, f.cfg.timeFormat())
 }
 
 func (f *field) Dur(key string, value time.Duration) log.FieldBuilder {
-	return f.Int64(key, int64(value/DurationFieldUnit))
+	return f.Int64(key, int64(value/f.cfg.durationFieldUnit()))
 }
 
 func (f *field) Stringer(key string, value fmt.Stringer) log.FieldBuilder {
@@ -267,14 +347,20 @@ func (f *field) Error(key string, value error) log.FieldBuilder {
 	if value == nil {
 		return f
 	}
-	return f.Str(key, value.Error())
+	f.appendError(key, value)
+	return f
 }
 
 func (f *field) Err(value error) log.FieldBuilder {
 	if value == nil {
 		return f
 	}
-	return f.Str(ErrorFieldName, value.Error())
+	f.markReserved(reservedErr)
+	f.appendError(f.cfg.errorFieldName(), value)
+	if f.stack && f.errStack == nil {
+		f.errStack = errorStack(value)
+	}
+	return f
 }
 
 func (f *field) Msgf(format string, args ...interface{}) log.FieldBuilder {
@@ -282,18 +368,48 @@ func (f *field) Msgf(format string, args ...interface{}) log.FieldBuilder {
 }
 
 func (f *field) Update(l log.Logger) log.Logger {
-	ll := l.(*logger).clone()
-	ll.buf = append(l.(*logger).buf, f.buf...)
+	l1, ok := l.(*logger)
+	if !ok {
+		putField(f)
+		return l
+	}
+	ll := l1.clone()
+	ll.buf = append(ll.buf, f.buf...)
 	putField(f)
 	return ll
 }
 
-func (f *field) send(out io.Writer) {
-	if TimestampEnabled {
-		f.Timef(TimestampFieldName, TimestampFunc(), TimestampFormat)
+func (f *field) send(l *logger, lv log.Level) {
+	if f.cfg.timestampEnabled() && !f.noTs {
+		ts := f.ts
+		if ts.IsZero() {
+			ts = f.cfg.timestamp()
+		}
+		f.markReserved(reservedTime)
+		f.Timef(f.cfg.timestampFieldName(), ts, f.cfg.timestampFormat())
+	}
+	buf := f.buf
+	if policy, ordered := f.cfg.dedupPolicy(), f.cfg.reservedFirst(); policy != DedupOff || ordered {
+		fields := newField()
+		fields.buf = f.appendFields(fields.buf, policy, ordered)
+		defer putField(fields)
+		buf = fields.buf
+	}
+	buf[0] = '{'
+	switch l.format {
+	case FormatConsole:
+		line := newField()
+		line.buf = appendConsole(line.buf, append(buf, '}'), f.cfg, lv, l.color)
+		l.write(lv, line.buf)
+		putField(line)
+	case FormatLogfmt:
+		line := newField()
+		line.buf = appendLogfmt(line.buf, append(buf, '}'), f.cfg)
+		l.write(lv, line.buf)
+		putField(line)
+	default:
+		l.write(lv, append(buf, "}\n"...))
 	}
-	f.buf[0] = '{'
-	out.Write(append(f.buf, "}\n"...))
 	putField(f)
 }
 
@@ -304,6 +420,14 @@ func (f *field) discard() {
 func newField() *field {
 	e := fieldPool.Get().(*field)
 	e.buf = e.buf[:0]
+	e.cfg = nil
+	e.ts = time.Time{}
+	e.noTs = false
+	e.stack = false
+	e.errStack = nil
+	e.hasStack = false
+	e.reservedAt = [reservedKeys]int{}
+	atomic.StoreUint32(&e.pooled, 0)
 	return e
 }
 
@@ -322,8 +446,11 @@ func putField(e *field) {
 	// to place back in the pool.
 	//
 	// See https://golang.org/issue/23199
+	//
+	// A FieldBuilder logged twice is put only once, otherwise the pool
+	// would give the same field to two goroutines.
 	const maxSize = 1 << 16 // 64KiB
-	if cap(e.buf) > maxSize {
+	if cap(e.buf) > maxSize || !atomic.CompareAndSwapUint32(&e.pooled, 0, 1) {
 		return
 	}
 	fieldPool.Put(e)
@@ -0,0 +1,201 @@
+package goplogjson
+
+import (
+	"encoding"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FloatPolicy defines how NaN and ±Inf float values, that are not valid
+// JSON numbers, are encoded
+type FloatPolicy uint8
+
+const (
+	// FloatString encodes the values as the strings "NaN", "+Inf" and "-Inf"
+	FloatString FloatPolicy = iota
+	// FloatNull encodes the values as null
+	FloatNull
+	// FloatOmit drops the field, or the key of a marshaled map or struct,
+	// inside an array the value is encoded as null
+	FloatOmit
+)
+
+// isFinite reports if v is neither NaN nor ±Inf
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// appendFloat appends v as a JSON value, non-finite values are encoded
+// according to policy, with FloatOmit handled as FloatNull
+func appendFloat(dst []byte, v float64, bitSize int, policy FloatPolicy) []byte {
+	if isFinite(v) {
+		return strconv.AppendFloat(dst, v, 'f', -1, bitSize)
+	}
+	if policy != FloatString {
+		return append(dst, "null"...)
+	}
+	switch {
+	case math.IsNaN(v):
+		return append(dst, `"NaN"`...)
+	case v > 0:
+		return append(dst, `"+Inf"`...)
+	}
+	return append(dst, `"-Inf"`...)
+}
+
+// float adds the field key with v
+func (f *field) float(key string, v float64, bitSize int) {
+	policy := f.cfg.floatPolicy()
+	if policy == FloatOmit && !isFinite(v) {
+		return
+	}
+	f.buf = appendFloat(appendKey(f.buf, key), v, bitSize, policy)
+}
+
+// isNonFiniteString reports if s is how json.UnsupportedValueError
+// reports a NaN or ±Inf float
+func isNonFiniteString(s string) bool {
+	return s == "NaN" || s == "+Inf" || s == "-Inf"
+}
+
+// maxReplaceDepth stops replaceNonFinite on cyclic values, json.Marshal
+// then reports the cycle
+const maxReplaceDepth = 1000
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// replaceNonFinite returns v, as json.Marshal would see it, with its NaN
+// and ±Inf floats replaced according to policy. Structs become maps with
+// the names of the json tags. It returns false when v itself is omitted
+func replaceNonFinite(v reflect.Value, policy FloatPolicy) (interface{}, bool) {
+	return replaceNonFiniteDepth(v, policy, 0)
+}
+
+func replaceNonFiniteDepth(v reflect.Value, policy FloatPolicy, depth int) (interface{}, bool) {
+	if !v.IsValid() {
+		return nil, true
+	}
+	if depth > maxReplaceDepth || !v.CanInterface() {
+		return nil, true
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface(), true
+	}
+	depth++
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if isFinite(f) {
+			return v.Interface(), true
+		}
+		switch {
+		case policy == FloatOmit:
+			return nil, false
+		case policy == FloatNull:
+			return nil, true
+		case math.IsNaN(f):
+			return "NaN", true
+		case f > 0:
+			return "+Inf", true
+		}
+		return "-Inf", true
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, true
+		}
+		return replaceNonFiniteDepth(v.Elem(), policy, depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, true
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), true
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			// inside an array FloatOmit is encoded as null
+			out[i], _ = replaceNonFiniteDepth(v.Index(i), policy, depth)
+		}
+		return out, true
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, true
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if e, ok := replaceNonFiniteDepth(iter.Value(), policy, depth); ok {
+				out[mapKey(iter.Key())] = e
+			}
+		}
+		return out, true
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		replaceStructFields(out, v, policy, depth)
+		return out, true
+	}
+	return v.Interface(), true
+}
+
+// replaceStructFields adds to out the fields of v json.Marshal encodes
+func replaceStructFields(out map[string]interface{}, v reflect.Value, policy FloatPolicy, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				replaceStructFields(out, fv, policy, depth)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(opts, ",omitempty") && fv.IsZero() {
+			continue
+		}
+		if e, ok := replaceNonFiniteDepth(fv, policy, depth); ok {
+			out[name] = e
+		}
+	}
+}
+
+// mapKey returns the key json.Marshal uses for k
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, _ := tm.MarshalText()
+		return string(b)
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	}
+	return strconv.FormatUint(k.Uint(), 10)
+}
@@ -0,0 +1,81 @@
+package goplogjson
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLoggerNonFiniteFloat(t *testing.T) {
+	tests := []struct {
+		policy FloatPolicy
+		want   string
+	}{
+		{FloatString, `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+			"nan":"NaN", "inf":"+Inf", "ninf":"-Inf", "f32":"NaN", "iface":"+Inf", "fields":"NaN", "c":"(NaN+1i)", "ok":1.5}`},
+		{FloatNull, `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+			"nan":null, "inf":null, "ninf":null, "f32":null, "iface":null, "fields":null, "c":null, "ok":1.5}`},
+		{FloatOmit, `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z", "ok":1.5}`},
+	}
+	for _, tt := range tests {
+		cfg := DefaultEncoderConfig()
+		cfg.NonFiniteFloatPolicy = tt.policy
+		out := new(strings.Builder)
+		l := New(WithOutput(out), WithEncoderConfig(cfg))
+		l.Inf(l.NewFieldBuilder().
+			Float64("nan", math.NaN()).
+			Float64("inf", math.Inf(1)).
+			Float64("ninf", math.Inf(-1)).
+			Float32("f32", float32(math.NaN())).
+			Interface("iface", math.Inf(1)).
+			Fields(map[string]interface{}{"fields": math.NaN()}).
+			Complex128("c", complex(math.NaN(), 1)).
+			Float64("ok", 1.5).
+			Msg("test"))
+		if diff := compareJson(tt.want, out.String()); diff != "" {
+			t.Errorf("policy %d: %s", tt.policy, diff)
+		}
+	}
+}
+
+func TestLoggerNonFiniteFloats(t *testing.T) {
+	cfg := DefaultEncoderConfig()
+	cfg.NonFiniteFloatPolicy = FloatOmit
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithEncoderConfig(cfg))
+	l.Inf(Extend(l.NewFieldBuilder()).Floats("floats", []float64{1, math.NaN()}))
+	want := `{"floats":[1,null],"level":"info","time":"2021-09-26T07:57:36Z"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %q and got %q", want, out.String())
+	}
+}
+
+func TestLoggerNonFiniteFloatValues(t *testing.T) {
+	type point struct {
+		X      float64 `json:"x"`
+		Y      float64
+		Hidden float64 `json:"-"`
+	}
+	tests := []struct {
+		policy FloatPolicy
+		want   string
+	}{
+		{FloatString, `{"arr":[1,"NaN"],"f32":[0.1,"NaN"],"map":{"a":"+Inf","b":1},"point":{"Y":"-Inf","x":2},"level":"info","time":"2021-09-26T07:57:36Z"}`},
+		{FloatNull, `{"arr":[1,null],"f32":[0.1,null],"map":{"a":null,"b":1},"point":{"Y":null,"x":2},"level":"info","time":"2021-09-26T07:57:36Z"}`},
+		{FloatOmit, `{"arr":[1,null],"f32":[0.1,null],"map":{"b":1},"point":{"x":2},"level":"info","time":"2021-09-26T07:57:36Z"}`},
+	}
+	for _, tt := range tests {
+		cfg := DefaultEncoderConfig()
+		cfg.NonFiniteFloatPolicy = tt.policy
+		out := new(strings.Builder)
+		l := New(WithOutput(out), WithEncoderConfig(cfg))
+		l.Inf(Extend(l.NewFieldBuilder()).
+			Array("arr", Arr().Float64(1).Float64(math.NaN())).
+			Interface("f32", []float32{0.1, float32(math.NaN())}).
+			Interface("map", map[string]float64{"a": math.Inf(1), "b": 1}).
+			Marshal("point", point{X: 2, Y: math.Inf(-1), Hidden: math.NaN()}))
+		if got := out.String(); got != tt.want+"\n" {
+			t.Errorf("policy %d: want %s and got %s", tt.policy, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package goplogjson
+
+import (
+	"io"
+	"os"
+
+	"github.com/axpira/gop/log"
+)
+
+// Format defines how the lines of a logger are written
+type Format uint8
+
+const (
+	// FormatJSON writes each line as a JSON object, it's the default
+	FormatJSON Format = iota
+	// FormatConsole writes each line as time, level and message followed
+	// by key=value pairs, to be read by humans in a terminal
+	FormatConsole
+	// FormatLogfmt writes each line as logfmt key=value pairs, starting
+	// with the timestamp, level and message fields.
+	// It's a conversion of the JSON line, see WithFormat
+	FormatLogfmt
+)
+
+// WithFormat sets the format of the lines. Fields are always encoded as
+// JSON by the FieldBuilder, FormatConsole and FormatLogfmt convert the
+// JSON line when it's written, so each line is encoded twice and costs
+// more than FormatJSON. The strings are decoded and quoted again with
+// the Go escapes, as logfmt parsers expect
+func WithFormat(format Format) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.format = format
+		l1.detectColor()
+		return l1
+	})
+}
+
+// WithColor forces the ANSI colors of FormatConsole on or off, whatever
+// the order of the options. By default they are used only when the
+// output is a terminal
+func WithColor(color bool) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.color = color
+		l1.colorForced = true
+		return l1
+	})
+}
+
+// detectColor enables the colors when the output is a terminal,
+// unless they were forced by WithColor
+func (l *logger) detectColor() {
+	if !l.colorForced {
+		l.color = isTerminal(l.out)
+	}
+}
+
+// isTerminal reports if w, or the writer wrapped by a locked or async
+// writer, is a terminal. NO_COLOR disables the colors as defined in
+// https://no-color.org
+func isTerminal(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	switch v := w.(type) {
+	case *lockedWriter:
+		return isTerminal(v.out)
+	case *AsyncWriter:
+		return isTerminal(v.out)
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -2,4 +2,4 @@ module github.com/axpira/goplogjson
 
 go 1.16
 
-require github.com/axpira/gop/log v0.2.0 // indirect
+require github.com/axpira/gop/log v0.2.0
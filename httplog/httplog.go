@@ -0,0 +1,214 @@
+// Package httplog provides a net/http middleware logging one access line
+// per request with a request scoped logger stored in the context
+package httplog
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/axpira/gop/log"
+	"github.com/axpira/goplogjson"
+)
+
+// Config defines how the requests are logged, the zero value is ready to use
+type Config struct {
+	// Logger is the parent of the request loggers, log.DefaultLogger when nil
+	Logger log.Logger
+	// Message is the message of the access line, "request" when empty
+	Message string
+	// RequestIDHeader is the header read and written with the request id,
+	// "X-Request-Id" when empty
+	RequestIDHeader string
+	// RequestIDFieldName defines the key name of the request id,
+	// "request_id" when empty
+	RequestIDFieldName string
+	// RequestIDFunc generates the request id when the request has none,
+	// by default 16 random bytes in hex
+	RequestIDFunc func() string
+	// SkipPaths are the paths not logged, the request logger is still
+	// stored in the context
+	SkipPaths []string
+	// Skip reports if a request is not logged
+	Skip func(*http.Request) bool
+	// LevelFunc returns the level of the access line for a status code,
+	// by default error for 5xx, warn for 4xx and info otherwise
+	LevelFunc func(status int) log.Level
+	// Headers are the request headers logged in the headers field
+	Headers []string
+}
+
+// maxRequestIDLen limits the size of a request id received in a header
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestID returns the request id stored in ctx by the middleware
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// DefaultLevel returns error for 5xx, warn for 4xx and info otherwise
+func DefaultLevel(status int) log.Level {
+	switch {
+	case status >= 500:
+		return log.ErrorLevel
+	case status >= 400:
+		return log.WarnLevel
+	}
+	return log.InfoLevel
+}
+
+func newRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// Middleware returns a middleware storing in the request context a logger
+// with the request id, see log.FromCtx, and logging an access line after
+// the handler returns, or with status 500 when it panics. A W3C traceparent
+// header is stored in the context, so the access line and the handler lines
+// can log the trace fields with Ctx. Loggers of other packages get the
+// access line without the trace fields
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	if cfg.Message == "" {
+		cfg.Message = "request"
+	}
+	if cfg.RequestIDHeader == "" {
+		cfg.RequestIDHeader = "X-Request-Id"
+	}
+	if cfg.RequestIDFieldName == "" {
+		cfg.RequestIDFieldName = "request_id"
+	}
+	if cfg.RequestIDFunc == nil {
+		cfg.RequestIDFunc = newRequestID
+	}
+	if cfg.LevelFunc == nil {
+		cfg.LevelFunc = DefaultLevel
+	}
+	skip := make(map[string]struct{}, len(cfg.SkipPaths))
+	for _, p := range cfg.SkipPaths {
+		skip[p] = struct{}{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			parent := cfg.Logger
+			if parent == nil {
+				parent = log.DefaultLogger
+			}
+
+			id := r.Header.Get(cfg.RequestIDHeader)
+			if id == "" || len(id) > maxRequestIDLen {
+				id = cfg.RequestIDFunc()
+			}
+			w.Header().Set(cfg.RequestIDHeader, id)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			if sc, err := goplogjson.ParseTraceparent(r.Header.Get("Traceparent")); err == nil {
+				ctx = goplogjson.ContextWithSpanContext(ctx, sc)
+			}
+			l := parent.With(parent.NewFieldBuilder().Str(cfg.RequestIDFieldName, id))
+			ctx = l.ToCtx(ctx)
+
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			if _, ok := skip[r.URL.Path]; ok || (cfg.Skip != nil && cfg.Skip(r)) {
+				next.ServeHTTP(rw, r.WithContext(ctx))
+				return
+			}
+			// the access line is logged while a panic goes up the stack
+			panicked := true
+			defer func() {
+				if panicked {
+					rw.status = http.StatusInternalServerError
+				}
+				logAccess(ctx, cfg, l, r, rw, start)
+			}()
+			next.ServeHTTP(rw, r.WithContext(ctx))
+			panicked = false
+		})
+	}
+}
+
+// logAccess logs the access line of r with the logger of the request
+func logAccess(ctx context.Context, cfg Config, l log.Logger, r *http.Request, rw *responseWriter, start time.Time) {
+	lv := cfg.LevelFunc(rw.status)
+	if !l.HasLevel(lv) {
+		return
+	}
+	fb := l.NewFieldBuilder()
+	if ext, ok := fb.(goplogjson.FieldBuilder); ok {
+		ext.Ctx(ctx)
+	}
+	fb.Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Int("status", rw.status).
+		Int64("bytes", rw.bytes).
+		Dur("duration", time.Since(start)).
+		Str("remote_addr", r.RemoteAddr).
+		Str("user_agent", r.UserAgent())
+	if len(cfg.Headers) > 0 {
+		headers := l.NewFieldBuilder()
+		for _, h := range cfg.Headers {
+			if v := r.Header.Get(h); v != "" {
+				headers.Str(h, v)
+			}
+		}
+		fb.Dict("headers", headers)
+	}
+	l.Log(lv, fb.Msg(cfg.Message))
+}
+
+// responseWriter records the status and the bytes written
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer does
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the wrapped writer does
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("httplog: response writer is not a http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
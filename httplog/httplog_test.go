@@ -0,0 +1,206 @@
+package httplog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/axpira/gop/log"
+	"github.com/axpira/goplogjson"
+)
+
+func serve(t *testing.T, cfg Config, req *http.Request, h http.HandlerFunc) (*httptest.ResponseRecorder, []map[string]interface{}) {
+	t.Helper()
+	out := new(strings.Builder)
+	cfg.Logger = goplogjson.New(goplogjson.WithOutput(out))
+	rec := httptest.NewRecorder()
+	Middleware(cfg)(h).ServeHTTP(rec, req)
+	return rec, parseLines(t, out.String())
+}
+
+func parseLines(t *testing.T, out string) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid json %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestMiddleware(t *testing.T) {
+	req := httptest.NewRequest("POST", "/users?x=1", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-Tenant", "t1")
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	cfg := Config{Headers: []string{"X-Tenant"}}
+	rec, lines := serve(t, cfg, req, func(w http.ResponseWriter, r *http.Request) {
+		if id := RequestID(r.Context()); id != "req-1" {
+			t.Errorf("want request id req-1 and got %q", id)
+		}
+		log.FromCtx(r.Context()).Info("handler")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	})
+	if got := rec.Header().Get("X-Request-Id"); got != "req-1" {
+		t.Errorf("want response request id req-1 and got %q", got)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines and got %v", lines)
+	}
+	if lines[0]["msg"] != "handler" || lines[0]["request_id"] != "req-1" {
+		t.Errorf("want handler line with request id and got %v", lines[0])
+	}
+	access := lines[1]
+	want := map[string]interface{}{
+		"msg":         "request",
+		"level":       "warn",
+		"request_id":  "req-1",
+		"method":      "POST",
+		"path":        "/users",
+		"status":      float64(404),
+		"bytes":       float64(9),
+		"remote_addr": "192.0.2.1:1234",
+		"user_agent":  "test-agent",
+		"trace_id":    "4bf92f3577b34da6a3ce929d0e0e4736",
+	}
+	for k, v := range want {
+		if access[k] != v {
+			t.Errorf("%s: want %v and got %v", k, v, access[k])
+		}
+	}
+	if _, ok := access["duration"].(float64); !ok {
+		t.Errorf("want duration and got %v", access["duration"])
+	}
+	if h, _ := access["headers"].(map[string]interface{}); h["X-Tenant"] != "t1" {
+		t.Errorf("want headers and got %v", access["headers"])
+	}
+}
+
+func TestMiddlewareGenerateRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	rec, lines := serve(t, Config{RequestIDFunc: func() string { return "gen" }}, req,
+		func(w http.ResponseWriter, r *http.Request) {})
+	if got := rec.Header().Get("X-Request-Id"); got != "gen" {
+		t.Errorf("want generated request id and got %q", got)
+	}
+	if len(lines) != 1 || lines[0]["request_id"] != "gen" || lines[0]["level"] != "info" ||
+		lines[0]["status"] != float64(200) {
+		t.Errorf("wrong access line %v", lines)
+	}
+}
+
+func TestMiddlewareSkip(t *testing.T) {
+	cfg := Config{
+		SkipPaths: []string{"/health"},
+		Skip:      func(r *http.Request) bool { return r.Method == "OPTIONS" },
+	}
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/health", nil),
+		httptest.NewRequest("OPTIONS", "/users", nil),
+	} {
+		_, lines := serve(t, cfg, req, func(w http.ResponseWriter, r *http.Request) {})
+		if len(lines) != 0 {
+			t.Errorf("%s %s: want no lines and got %v", req.Method, req.URL.Path, lines)
+		}
+	}
+}
+
+func TestMiddlewareLevelFunc(t *testing.T) {
+	cfg := Config{LevelFunc: func(status int) log.Level { return log.DebugLevel }}
+	req := httptest.NewRequest("GET", "/", nil)
+	_, lines := serve(t, cfg, req, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if len(lines) != 0 {
+		t.Errorf("want access line below the logger level dropped and got %v", lines)
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	out := new(strings.Builder)
+	cfg := Config{Logger: goplogjson.New(goplogjson.WithOutput(out))}
+	h := Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("want panic boom and got %v", p)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	lines := parseLines(t, out.String())
+	if len(lines) != 1 || lines[0]["status"] != float64(500) || lines[0]["level"] != "error" {
+		t.Errorf("want access line with status 500 and got %v", lines)
+	}
+}
+
+// foreignLogger wraps a logger so its FieldBuilders are not the ones of
+// goplogjson, like a logger of another package
+type foreignLogger struct{ log.Logger }
+
+type foreignFields struct{ log.FieldBuilder }
+
+func unwrapFields(fb log.FieldBuilder) log.FieldBuilder {
+	if f, ok := fb.(foreignFields); ok {
+		return f.FieldBuilder
+	}
+	return fb
+}
+
+func (l foreignLogger) NewFieldBuilder() log.FieldBuilder {
+	return foreignFields{l.Logger.NewFieldBuilder()}
+}
+
+func (l foreignLogger) With(opts ...log.LoggerOption) log.Logger {
+	for i, opt := range opts {
+		if f, ok := opt.(foreignFields); ok {
+			opts[i] = f.FieldBuilder
+		}
+	}
+	return foreignLogger{l.Logger.With(opts...)}
+}
+
+func (l foreignLogger) Log(lv log.Level, fb log.FieldBuilder) {
+	l.Logger.Log(lv, unwrapFields(fb))
+}
+
+func (f foreignFields) Dict(key string, fb log.FieldBuilder) log.FieldBuilder {
+	return f.FieldBuilder.Dict(key, unwrapFields(fb))
+}
+
+func TestMiddlewareForeignLogger(t *testing.T) {
+	out := new(strings.Builder)
+	cfg := Config{
+		Logger:  foreignLogger{goplogjson.New(goplogjson.WithOutput(out))},
+		Headers: []string{"X-Tenant"},
+	}
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-Tenant", "t1")
+	Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), req)
+	lines := parseLines(t, out.String())
+	if len(lines) != 1 {
+		t.Fatalf("want 1 line and got %v", lines)
+	}
+	access := lines[0]
+	if access["msg"] != "request" || access["request_id"] != "req-1" ||
+		access["path"] != "/users" || access["status"] != float64(200) {
+		t.Errorf("wrong access line %v", access)
+	}
+	if h, _ := access["headers"].(map[string]interface{}); h["X-Tenant"] != "t1" {
+		t.Errorf("want headers and got %v", access["headers"])
+	}
+}
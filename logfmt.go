@@ -0,0 +1,39 @@
+package goplogjson
+
+// appendLogfmt converts the JSON object line to logfmt, the timestamp,
+// level and message fields are written first. It's a second pass over
+// the line, strings are decoded and quoted with the logfmt rules
+func appendLogfmt(dst, line []byte, cfg *EncoderConfig) []byte {
+	var ts, lv, msg []byte
+	for key, value, rest, ok := nextField(line); ok; key, value, rest, ok = nextField(rest) {
+		switch {
+		case keyIs(key, cfg.timestampFieldName()):
+			ts = value
+		case keyIs(key, cfg.levelFieldName()):
+			lv = value
+		case keyIs(key, cfg.messageFieldName()):
+			msg = value
+		}
+	}
+	start := len(dst)
+	dst = appendLogfmtReserved(dst, cfg.timestampFieldName(), ts)
+	dst = appendLogfmtReserved(dst, cfg.levelFieldName(), lv)
+	dst = appendLogfmtReserved(dst, cfg.messageFieldName(), msg)
+	var arr [128]byte
+	dst = appendTextFields(dst, line, arr[:0], cfg, textLogfmt, false)
+	// every pair starts with a space
+	if len(dst) > start {
+		dst = append(dst[:start], dst[start+1:]...)
+	}
+	return append(dst, '\n')
+}
+
+func appendLogfmtReserved(dst []byte, name string, value []byte) []byte {
+	if value == nil {
+		return dst
+	}
+	dst = append(dst, ' ')
+	dst = append(dst, name...)
+	dst = append(dst, '=')
+	return appendTextValue(dst, value, textLogfmt)
+}
@@ -0,0 +1,36 @@
+package goplogjson
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogfmtFormat(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithFormat(FormatLogfmt))
+	l = l.With(l.NewFieldBuilder().Str("app", "test"))
+	l.Err(l.NewFieldBuilder().
+		Msg("hello world").
+		Str("key", "value").
+		Str("empty", "").
+		Str("quote", `say "hi"`).
+		Str("new line", "a\nb").
+		Str("ctl", "a\x01b\u2028").
+		Str("utf8", "ção").
+		Bytes("eq", []byte("a=b")).
+		Float64("float", 1.5).
+		Marshal("list", []string{"a", "b c"}).
+		Dict("dict", l.NewFieldBuilder().
+			Int("int", 1).
+			Dict("inner", l.NewFieldBuilder().Bool("ok", true)).
+			Dict("empty", l.NewFieldBuilder())).
+		Err(errors.New("failed")),
+	)
+	want := `time=2021-09-26T07:57:36Z level=error msg="hello world" key=value empty="" ` +
+		`quote="say \"hi\"" new_line="a\nb" ctl="a\x01b\u2028" utf8=ção eq="a=b" float=1.5 list="[\"a\",\"b c\"]" ` +
+		`dict.int=1 dict.inner.ok=true dict.empty={} err=failed app=test` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("want %q and got %q", want, got)
+	}
+}
@@ -9,15 +9,24 @@ import (
 	"github.com/axpira/gop/log"
 )
 
-type contextKey string
+// loggerContextKey is the key of the logger stored by ToCtx
+type loggerContextKey struct{}
 
-const (
-	loggerContextKey contextKey = "logger"
-)
+var levelHook = map[log.Level]func(out io.Writer){
+	log.PanicLevel: panicHook,
+	log.FatalLevel: fatalHook,
+}
 
-var levelHook = map[log.Level]func(){
-	log.PanicLevel: func() { panic("") },
-	log.FatalLevel: func() { os.Exit(1) },
+// panicHook and fatalHook flush out, the output of the logger, and the
+// registered sinks within FlushTimeout, so the lines logged are not lost
+func panicHook(out io.Writer) {
+	syncSinks(FlushTimeout, out)
+	panic("")
+}
+
+func fatalHook(out io.Writer) {
+	syncSinks(FlushTimeout, out)
+	os.Exit(1)
 }
 
 func init() {
@@ -28,6 +37,7 @@ func WithOutput(out io.Writer) log.LoggerOption {
 	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
 		l1 := l.(*logger)
 		l1.out = out
+		l1.detectColor()
 		return l1
 	})
 }
@@ -40,11 +50,32 @@ func WithLevel(lv log.Level) log.LoggerOption {
 	})
 }
 
+// WithErrorHandler sets a function called when the output fails to write a line
+func WithErrorHandler(fn func(error)) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.errorHandler = fn
+		return l1
+	})
+}
+
+// WithFallback sets a writer, like os.Stderr, that receives the lines
+// the output failed to write
+func WithFallback(out io.Writer) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.fallback = out
+		return l1
+	})
+}
+
 func newLogger() *logger {
 	return &logger{
-		buf:   make([]byte, 0, 500),
-		level: log.InfoLevel,
-		out:   os.Stdout,
+		buf:        make([]byte, 0, 500),
+		level:      log.InfoLevel,
+		out:        os.Stdout,
+		stdLevel:   log.InfoLevel,
+		stackLevel: log.DisabledLevel,
 	}
 }
 
@@ -53,15 +84,39 @@ func New(opts ...log.LoggerOption) log.Logger {
 }
 
 type logger struct {
-	buf   []byte
-	level log.Level
-	out   io.Writer
+	buf          []byte
+	level        log.Level
+	out          io.Writer
+	fallback     io.Writer
+	errorHandler func(error)
+	cfg          *EncoderConfig
+	format       Format
+	color        bool
+	colorForced  bool
+	caller       bool
+	callerSkip   int
+	stackLevel   log.Level
+	// stdLevel and stdFlags are used by Write, see NewStdLogger
+	stdLevel log.Level
+	stdFlags int
 }
 
 func (l *logger) clone() *logger {
-	lNew := &logger{buf: make([]byte, 0, 500), level: l.level, out: l.out}
+	lNew := *l
+	lNew.buf = make([]byte, 0, 500)
 	lNew.buf = append(lNew.buf, l.buf...)
-	return lNew
+	return &lNew
+}
+
+// Sync flushes the output of the logger
+func (l *logger) Sync() error {
+	return syncWriter(l.out)
+}
+
+// Close flushes and closes the output of the logger,
+// standard output and error are never closed
+func (l *logger) Close() error {
+	return closeWriter(l.out)
 }
 
 func (l *logger) Level() log.Level {
@@ -72,11 +127,17 @@ func (l *logger) HasLevel(lv log.Level) bool {
 	return lv >= l.level
 }
 
+// NewFieldBuilder returns a FieldBuilder from a pool, it's returned to the
+// pool when logged or added to another FieldBuilder or logger and must not
+// be used again
 func (l *logger) NewFieldBuilder() log.FieldBuilder {
 	if l.level == log.DisabledLevel {
 		return emptyFieldPtr
 	}
-	return newField()
+	f := newField()
+	f.cfg = l.cfg
+	f.stack = l.stackLevel != log.DisabledLevel
+	return f
 }
 
 func (l *logger) With(opts ...log.LoggerOption) log.Logger {
@@ -89,7 +150,7 @@ func (l *logger) With(opts ...log.LoggerOption) log.Logger {
 
 func (l *logger) Log(lv log.Level, fieldBuilder log.FieldBuilder) {
 	if fn, ok := levelHook[lv]; ok {
-		defer fn()
+		defer fn(l.out)
 	}
 	if !l.HasLevel(lv) || fieldBuilder == emptyFieldPtr {
 		if fieldBuilder != emptyFieldPtr {
@@ -98,9 +159,37 @@ func (l *logger) Log(lv log.Level, fieldBuilder log.FieldBuilder) {
 		return
 	}
 	field := fieldBuilder.(*field)
-	field.Str(LevelFieldName, LevelNameFunc(lv))
+	field.cfg = l.cfg
+	if l.caller {
+		if frame, ok := callerFrame(l.callerSkip); ok {
+			field.appendCaller(frame)
+		}
+	}
+	if lv >= l.stackLevel && !field.hasStack {
+		if field.errStack != nil {
+			field.appendStack(field.errStack.StackTrace())
+		} else {
+			field.appendStack(callersStack())
+		}
+	}
+	field.markReserved(reservedLevel)
+	field.Str(l.cfg.levelFieldName(), l.cfg.levelName(lv))
 	field.buf = append(field.buf, l.buf...)
-	field.send(l.out)
+	field.send(l, lv)
+}
+
+// write sends a line to the output, when it fails the line is sent to
+// the fallback writer and the error handler is called
+func (l *logger) write(lv log.Level, line []byte) {
+	if _, err := writeLevel(l.out, lv, line); err != nil {
+		countFailedWrite()
+		if l.fallback != nil {
+			writeLevel(l.fallback, lv, line)
+		}
+		if l.errorHandler != nil {
+			l.errorHandler(err)
+		}
+	}
 }
 
 func (l *logger) Trc(f log.FieldBuilder) {
@@ -199,19 +288,51 @@ func (l *logger) Printf(format string, args ...interface{}) {
 	l.Log(log.InfoLevel, l.NewFieldBuilder().Msgf(format, args...))
 }
 
+// Write logs msg as a message, without the trailing new line.
+// When the logger has standard log flags (see WithStdFlags) the header
+// written by the standard log package is parsed into fields
 func (l *logger) Write(msg []byte) (int, error) {
-	l.Log(log.InfoLevel, l.NewFieldBuilder().Msg(string(msg)))
-	return 0, nil
+	n := len(msg)
+	if !l.HasLevel(l.stdLevel) {
+		return n, nil
+	}
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	f := l.NewFieldBuilder().(*field)
+	if l.stdFlags != 0 {
+		msg = f.parseStdHeader(msg, l.stdFlags)
+	}
+	f.markReserved(reservedMsg)
+	f.Bytes(l.cfg.messageFieldName(), msg)
+	l.Log(l.stdLevel, f)
+	return n, nil
 }
 
+// FromCtx returns the logger stored in ctx by ToCtx, of any log.Logger
+// implementation, or l when there is none
 func (l *logger) FromCtx(ctx context.Context) log.Logger {
-	lg := ctx.Value(loggerContextKey)
-	if lg == nil {
+	if ctx == nil {
 		return l
 	}
-	return lg.(*logger)
+	if lg, ok := ctx.Value(loggerContextKey{}).(log.Logger); ok && lg != nil {
+		return lg
+	}
+	return l
 }
 
+// ToCtx returns a copy of ctx with l, a nil ctx is replaced by
+// context.Background
 func (l *logger) ToCtx(ctx context.Context) context.Context {
-	return context.WithValue(ctx, loggerContextKey, l)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, loggerContextKey{}, log.Logger(l))
+}
+
+// ContextWith returns a copy of ctx with the logger of ctx, or
+// log.DefaultLogger, updated by opts. A FieldBuilder is an option,
+// so this adds fields to the logger of the context in one call
+func ContextWith(ctx context.Context, opts ...log.LoggerOption) context.Context {
+	return log.DefaultLogger.FromCtx(ctx).With(opts...).ToCtx(ctx)
 }
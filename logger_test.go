@@ -6,6 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	stdlog "log"
+	"math"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -125,6 +129,200 @@ func TestLoggerContext(t *testing.T) {
 	}
 }
 
+// otherLogger is a log.Logger of another implementation
+type otherLogger struct {
+	log.Logger
+}
+
+func TestLoggerFromCtxOtherLogger(t *testing.T) {
+	other := otherLogger{}
+	ctx := context.WithValue(context.Background(), loggerContextKey{}, log.Logger(other))
+	if lg := New().FromCtx(ctx); lg != other {
+		t.Errorf("want %v and got %v", other, lg)
+	}
+	ctx = context.WithValue(context.Background(), loggerContextKey{}, "not a logger")
+	l := New()
+	if lg := l.FromCtx(ctx); lg != l {
+		t.Errorf("want fallback logger and got %v", lg)
+	}
+	var nilCtx context.Context
+	if lg := l.FromCtx(nilCtx); lg != l {
+		t.Errorf("want fallback logger and got %v", lg)
+	}
+	if lg := l.ToCtx(nilCtx).Value(loggerContextKey{}); lg != l {
+		t.Errorf("want logger in context and got %v", lg)
+	}
+}
+
+func TestContextWith(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out))
+	ctx := l.ToCtx(context.Background())
+	ctx = ContextWith(ctx, l.NewFieldBuilder().Str("request_id", "abc"))
+	ctx = ContextWith(ctx, l.NewFieldBuilder().Int("user", 42))
+	log.DefaultLogger.FromCtx(ctx).Info("test")
+
+	want := `{"request_id":"abc", "user":42, "level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestLoggerEncoderConfig(t *testing.T) {
+	cfg := DefaultEncoderConfig()
+	cfg.LevelFieldName = "severity"
+	cfg.MessageFieldName = "message"
+	cfg.ErrorFieldName = "error"
+	cfg.TimestampFieldName = "ts"
+	cfg.DurationFieldUnit = time.Second
+	cfg.LevelNameFunc = func(lv log.Level) string {
+		return strings.ToUpper(LevelNameFunc(lv))
+	}
+
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithEncoderConfig(cfg)).
+		With(fielder.Str("key", "value"))
+	l.Err(l.NewFieldBuilder().Msg("test").Err(errors.New("failed")).Dur("dur", dur))
+
+	want := `{"key":"value", "severity":"ERROR", "message":"test", "error":"failed", "dur":3754, "ts":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+
+	out.Reset()
+	New(WithOutput(out)).Info("test")
+	want = `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestLoggerSparseEncoderConfig(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithEncoderConfig(EncoderConfig{LevelFieldName: "severity"}))
+	l.Inf(l.NewFieldBuilder().Msg("hi").Dur("dur", dur).Err(errors.New("failed")))
+
+	want := `{"severity":"info", "msg":"hi", "dur":3754000, "err":"failed", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+
+	out.Reset()
+	l = New(WithOutput(out), WithEncoderConfig(EncoderConfig{TimestampDisabled: true}))
+	l.Info("hi")
+	if want := `{"msg":"hi","level":"info"}` + "\n"; out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+}
+
+func TestLoggerEncoderConfigOverGlobals(t *testing.T) {
+	oldTs, oldFirst, oldChain := TimestampEnabled, ReservedFirst, ErrorChainEnabled
+	oldFloat, oldDedup := NonFiniteFloatPolicy, DuplicateKeyPolicy
+	defer func() {
+		TimestampEnabled, ReservedFirst, ErrorChainEnabled = oldTs, oldFirst, oldChain
+		NonFiniteFloatPolicy, DuplicateKeyPolicy = oldFloat, oldDedup
+	}()
+	TimestampEnabled, ReservedFirst, ErrorChainEnabled = false, true, true
+	NonFiniteFloatPolicy, DuplicateKeyPolicy = FloatNull, DedupKeepLast
+
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithEncoderConfig(EncoderConfig{LevelFieldName: "severity"}))
+	l.Inf(l.NewFieldBuilder().Str("a", "1").Str("a", "2").Float64("f", math.NaN()).Err(errors.New("failed")).Msg("hi"))
+	want := `{"a":"1","a":"2","f":"NaN","err":"failed","msg":"hi","severity":"info","time":"2021-09-26T07:57:36Z"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+
+	out.Reset()
+	l = New(WithOutput(out), WithDedup(DedupKeepFirst))
+	l.Inf(l.NewFieldBuilder().Str("a", "1").Str("a", "2").Msg("hi"))
+	want = `{"a":"1","msg":"hi","level":"info","time":"2021-09-26T07:57:36Z"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+}
+
+func TestLoggerWrite(t *testing.T) {
+	tests := map[string]struct {
+		flags int
+		line  string
+		want  string
+	}{
+		"must trim new line": {
+			line: "hello\n",
+			want: `{"level":"info", "msg":"hello", "time":"2021-09-26T07:57:36Z"}`,
+		},
+		"must parse date, time and file": {
+			flags: stdlog.LstdFlags | stdlog.Lmicroseconds | stdlog.Lshortfile | stdlog.LUTC,
+			line:  "2020/01/02 03:04:05.000006 main.go:42: hello\n",
+			want:  `{"level":"info", "msg":"hello", "caller":"main.go:42", "time":"2020-01-02T03:04:05Z"}`,
+		},
+		"must parse time without date": {
+			flags: stdlog.Ltime | stdlog.LUTC,
+			line:  "03:04:05 hello\n",
+			want:  `{"level":"info", "msg":"hello", "time":"2021-09-26T03:04:05Z"}`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := new(strings.Builder)
+			l := New(WithOutput(out), WithStdFlags(tc.flags))
+			n, err := l.Write([]byte(tc.line))
+			if n != len(tc.line) || err != nil {
+				t.Errorf("want (%d, nil) and got (%d, %v)", len(tc.line), n, err)
+			}
+			if diff := compareJson(tc.want, out.String()); diff != "" {
+				t.Errorf(diff)
+			}
+		})
+	}
+}
+
+func TestNewStdLogger(t *testing.T) {
+	out := new(strings.Builder)
+	std := NewStdLogger(New(WithOutput(out)), log.WarnLevel, stdlog.Lshortfile)
+	std.Print("hello")
+
+	got, err := stringToMap(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["level"] != "warn" || got["msg"] != "hello" || !strings.HasPrefix(got["caller"].(string), "logger_test.go:") {
+		t.Errorf("unexpected line %s", out.String())
+	}
+}
+
+func TestLoggerCaller(t *testing.T) {
+	out := new(strings.Builder)
+	cfg := DefaultEncoderConfig()
+	cfg.CallerFuncFieldName = "func"
+	l := New(WithOutput(out), WithCaller(0), WithEncoderConfig(cfg))
+	_, file, line, _ := runtime.Caller(0)
+	l.Info("test")
+
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+		"caller":"` + PackageCaller(file, line+1) + `",
+		"func":"github.com/axpira/goplogjson.TestLoggerCaller"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+
+	out.Reset()
+	cfg.CallerFuncFieldName = ""
+	cfg.CallerFormatter = ShortCaller
+	helper := func(l log.Logger) {
+		l.Log(log.InfoLevel, l.NewFieldBuilder().Msg("test"))
+	}
+	_, _, line, _ = runtime.Caller(0)
+	helper(New(WithOutput(out), WithCaller(1), WithEncoderConfig(cfg)))
+
+	want = `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+		"caller":"logger_test.go:` + strconv.Itoa(line+1) + `"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
 var levelFuncs = map[log.Level]func(log.Logger, log.FieldBuilder, string, string, ...interface{}){
 	log.TraceLevel: func(l log.Logger, fb log.FieldBuilder, msg string, format string, args ...interface{}) {
 		l.Trc(fb)
@@ -425,3 +623,14 @@ func stringToMap(str string) (map[string]interface{}, error) {
 	}
 	return m, nil
 }
+
+func TestRangeFields(t *testing.T) {
+	var got []string
+	RangeFields([]byte(`{"msg":"a \"b\"\nc","n":1,"d":{"k":"v"}}`+"\n"), func(key, value []byte) {
+		got = append(got, string(key)+"="+string(value))
+	})
+	want := []string{"msg=a \"b\"\nc", "n=1", `d={"k":"v"}`}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("want %q and got %q", want, got)
+	}
+}
@@ -0,0 +1,74 @@
+package goplogjson
+
+import (
+	"sort"
+
+	"github.com/axpira/gop/log"
+)
+
+// WithReservedFirst writes the time, level and msg fields first and sorts
+// the keys of Fields, see EncoderConfig.ReservedFirst
+func WithReservedFirst() log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		cfg := l1.config()
+		cfg.ReservedFirst = true
+		l1.cfg = &cfg
+		return l1
+	})
+}
+
+// reservedOrder is the order of the reserved fields written first
+var reservedOrder = [...]int{reservedTime, reservedLevel, reservedMsg}
+
+// appendFields appends the fields of f.buf to dst applying the duplicate
+// key policy and, when ordered, writing the reserved fields first
+func (f *field) appendFields(dst []byte, policy DedupPolicy, ordered bool) []byte {
+	var arr [32]segment
+	segs := f.segments(arr[:0])
+	if policy != DedupOff {
+		f.markConflicts(segs, policy)
+	}
+	var seen map[string]struct{}
+	if ordered {
+		names := f.cfg.reservedNames()
+		for _, r := range reservedOrder {
+			if i := reservedSegment(segs, r, names[r]); i >= 0 {
+				dst = f.appendSegment(dst, segs, &segs[i], policy, &seen)
+				segs[i].written = true
+			}
+		}
+	}
+	for i := range segs {
+		if !segs[i].written {
+			dst = f.appendSegment(dst, segs, &segs[i], policy, &seen)
+		}
+	}
+	return dst
+}
+
+// reservedSegment returns the index of the reserved field r, written by
+// the logger, or else of the first field named name. It's -1 when there
+// is no such field
+func reservedSegment(segs []segment, r int, name string) int {
+	first := -1
+	for i, s := range segs {
+		if s.reserved == r+1 {
+			return i
+		}
+		if first < 0 && !s.conflict && keyIs(s.key, name) {
+			first = i
+		}
+	}
+	return first
+}
+
+// sortedKeys returns the keys of m in increasing order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,30 @@
+package goplogjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoggerReservedFirst(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithReservedFirst())
+	l = l.With(l.NewFieldBuilder().Str("ctx", "v"))
+	l.Inf(l.NewFieldBuilder().
+		Str("a", "1").
+		Fields(map[string]interface{}{"z": 1, "b": 2, "m": 3}).
+		Msg("test"))
+	want := `{"time":"2021-09-26T07:57:36Z","level":"info","msg":"test","a":"1","b":2,"m":3,"z":1,"ctx":"v"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+}
+
+func TestLoggerReservedFirstDedup(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithReservedFirst(), WithDedup(DedupRename))
+	l.Inf(l.NewFieldBuilder().Str("level", "fake").Str("a", "1").Msg("test"))
+	want := `{"time":"2021-09-26T07:57:36Z","level":"info","msg":"test","level_1":"fake","a":"1"}` + "\n"
+	if out.String() != want {
+		t.Errorf("want %s and got %s", want, out.String())
+	}
+}
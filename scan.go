@@ -0,0 +1,165 @@
+package goplogjson
+
+import (
+	"unicode/utf8"
+)
+
+// The functions below read the JSON written by field, so they only
+// handle compact JSON without spaces between the tokens
+
+// nextField returns the raw key, with quotes, and the raw value of the
+// first field of buf, that starts with the '{' or ',' before the field.
+// ok is false when there are no more fields
+func nextField(buf []byte) (key, value, rest []byte, ok bool) {
+	if len(buf) < 2 || (buf[0] != '{' && buf[0] != ',') || buf[1] != '"' {
+		return nil, nil, nil, false
+	}
+	end := skipString(buf, 1)
+	if end >= len(buf) || buf[end] != ':' {
+		return nil, nil, nil, false
+	}
+	vend := skipValue(buf, end+1)
+	return buf[1:end], buf[end+1 : vend], buf[vend:], true
+}
+
+// skipString returns the index after the string starting at buf[i]
+func skipString(buf []byte, i int) int {
+	for j := i + 1; j < len(buf); j++ {
+		switch buf[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(buf)
+}
+
+// skipValue returns the index after the value starting at buf[i]
+func skipValue(buf []byte, i int) int {
+	if i >= len(buf) {
+		return i
+	}
+	switch buf[i] {
+	case '"':
+		return skipString(buf, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(buf); j++ {
+			switch buf[j] {
+			case '"':
+				j = skipString(buf, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return len(buf)
+	}
+	for j := i; j < len(buf); j++ {
+		switch buf[j] {
+		case ',', '}', ']':
+			return j
+		}
+	}
+	return len(buf)
+}
+
+// keyIs reports if the raw key, with quotes, is name
+func keyIs(key []byte, name string) bool {
+	return len(key) == len(name)+2 && string(key[1:len(key)-1]) == name
+}
+
+// appendUnquoted appends the content of the JSON string s decoding its escapes
+func appendUnquoted(dst, s []byte) []byte {
+	if len(s) < 2 || s[0] != '"' {
+		return append(dst, s...)
+	}
+	s = s[1 : len(s)-1]
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b != '\\' || i+1 == len(s) {
+			dst = append(dst, b)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			dst = append(dst, '\b')
+		case 'f':
+			dst = append(dst, '\f')
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'u':
+			r, n := decodeHexRune(s[i+1:])
+			if n == 0 {
+				dst = append(dst, '\\', 'u')
+				continue
+			}
+			i += n
+			dst = appendRune(dst, r)
+		default:
+			dst = append(dst, s[i])
+		}
+	}
+	return dst
+}
+
+func decodeHexRune(s []byte) (rune, int) {
+	if len(s) < 4 {
+		return 0, 0
+	}
+	var r rune
+	for _, c := range s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, 0
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, 4
+}
+
+func appendRune(dst []byte, r rune) []byte {
+	var arr [utf8.UTFMax]byte
+	n := utf8.EncodeRune(arr[:], r)
+	return append(dst, arr[:n]...)
+}
+
+// RangeFields calls fn with the key and the value of each top level field
+// of the JSON line written by a logger, strings are unquoted and the other
+// values are raw JSON. key and value are valid only during the call
+func RangeFields(line []byte, fn func(key, value []byte)) {
+	var arr [256]byte
+	scratch := arr[:0]
+	rest := line
+	for {
+		key, value, next, ok := nextField(rest)
+		if !ok {
+			return
+		}
+		scratch = appendUnquoted(scratch[:0], key)
+		k := len(scratch)
+		if len(value) > 0 && value[0] == '"' {
+			scratch = appendUnquoted(scratch, value)
+		} else {
+			scratch = append(scratch, value...)
+		}
+		fn(scratch[:k], scratch[k:])
+		rest = next
+	}
+}
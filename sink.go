@@ -0,0 +1,150 @@
+package goplogjson
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// FlushTimeout is the max time Fatal and Panic wait for the registered
+// sinks to be flushed before exiting or panicking
+var FlushTimeout = 5 * time.Second
+
+// ErrFlushTimeout is returned by SyncSinks when the sinks were not flushed in time
+var ErrFlushTimeout = errors.New("goplogjson: timeout flushing sinks")
+
+// Syncer is implemented by the loggers created by New
+type Syncer interface {
+	// Sync flushes the output of the logger
+	Sync() error
+	// Close flushes and closes the output of the logger
+	Close() error
+}
+
+type flusher interface {
+	Flush() error
+}
+
+type syncer interface {
+	Sync() error
+}
+
+var sinks = struct {
+	sync.Mutex
+	m map[io.Writer]struct{}
+}{m: make(map[io.Writer]struct{})}
+
+// RegisterSink adds w to the writers flushed by SyncSinks, until
+// UnregisterSink or the Close of a logger writing to w.
+// Only writers with a Flush or Sync method are registered. The output of
+// the logger logging a Panic or Fatal is flushed without registering it,
+// register the other writers that must be flushed before exiting
+func RegisterSink(w io.Writer) {
+	if !needsSync(w) {
+		return
+	}
+	sinks.Lock()
+	sinks.m[w] = struct{}{}
+	sinks.Unlock()
+}
+
+// UnregisterSink removes w from the writers flushed by SyncSinks
+func UnregisterSink(w io.Writer) {
+	if !needsSync(w) {
+		return
+	}
+	sinks.Lock()
+	delete(sinks.m, w)
+	sinks.Unlock()
+}
+
+// SyncSinks flushes every registered sink, waiting at most timeout.
+// It returns the first error found or ErrFlushTimeout
+func SyncSinks(timeout time.Duration) error {
+	return syncSinks(timeout, nil)
+}
+
+// syncSinks flushes out, when it's not registered, and the registered
+// sinks under the same timeout
+func syncSinks(timeout time.Duration, out io.Writer) error {
+	sinks.Lock()
+	ws := make([]io.Writer, 0, len(sinks.m)+1)
+	for w := range sinks.m {
+		ws = append(ws, w)
+	}
+	if needsSync(out) {
+		if _, ok := sinks.m[out]; !ok {
+			ws = append(ws, out)
+		}
+	}
+	sinks.Unlock()
+	return syncWriters(ws, timeout)
+}
+
+// syncWriters flushes ws, waiting at most timeout
+func syncWriters(ws []io.Writer, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		var first error
+		for _, w := range ws {
+			if err := syncWriter(w); err != nil && first == nil {
+				first = err
+			}
+		}
+		done <- first
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrFlushTimeout
+	}
+}
+
+func isStdStream(w io.Writer) bool {
+	return w == os.Stdout || w == os.Stderr
+}
+
+func needsSync(w io.Writer) bool {
+	if w == nil || isStdStream(w) || !reflect.TypeOf(w).Comparable() {
+		return false
+	}
+	switch w.(type) {
+	case flusher, syncer:
+		return true
+	}
+	return false
+}
+
+// syncWriter flushes w when it's buffered (Flush) or persistent (Sync).
+// Standard output and error are not buffered and Sync fails when they
+// are a terminal or a pipe, so they are skipped
+func syncWriter(w io.Writer) error {
+	if isStdStream(w) {
+		return nil
+	}
+	switch v := w.(type) {
+	case flusher:
+		return v.Flush()
+	case syncer:
+		return v.Sync()
+	}
+	return nil
+}
+
+// closeWriter flushes and closes w, standard output and error are never closed
+func closeWriter(w io.Writer) error {
+	UnregisterSink(w)
+	err := syncWriter(w)
+	if c, ok := w.(io.Closer); ok && !isStdStream(w) {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,376 @@
+// Package file provides a writer to a file rotated by size and by time,
+// to be used with goplogjson.WithOutput
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// backupTimeFormat is the layout of the time added to the backup names
+const backupTimeFormat = "20060102T150405.000"
+
+// ErrClosed is returned when writing to a closed Writer
+var ErrClosed = errors.New("file: writer closed")
+
+// Config defines the file and when it's rotated
+type Config struct {
+	// Filename is the file written, its directory is created when missing
+	Filename string
+	// MaxSize is the size in bytes that rotates the file, 0 disables it
+	MaxSize int64
+	// Interval rotates the file when the current interval, like every
+	// hour or day, ends. 0 disables it
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept, 0 keeps all
+	MaxBackups int
+	// Compress gzips the rotated files in the background
+	Compress bool
+	// Perm is the permission of the files, 0644 when 0
+	Perm os.FileMode
+	// ReopenOnSIGHUP reopens the file when the process receives SIGHUP,
+	// used when another tool moves the file
+	ReopenOnSIGHUP bool
+	// ErrorHandler is called when a rotation fails, the lines are still
+	// written to the current file and the rotation is retried on the
+	// next write
+	ErrorHandler func(error)
+}
+
+// Writer writes to a file rotated by size and by time, it's safe for
+// concurrent use
+type Writer struct {
+	cfg Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	// lastStamp and lastN are the time and suffix of the last backup, the
+	// suffixes only grow so a backup never takes a number freed by mill
+	lastStamp string
+	lastN     int
+
+	// mill compresses and removes the backups, one rotation at a time
+	millMu sync.Mutex
+	wg     sync.WaitGroup
+
+	sighup chan os.Signal
+	done   chan struct{}
+}
+
+// New opens the file of cfg, appending to it when it exists
+func New(cfg Config) (*Writer, error) {
+	if cfg.Perm == 0 {
+		cfg.Perm = 0644
+	}
+	w := &Writer{
+		cfg:  cfg,
+		now:  time.Now,
+		done: make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	if cfg.ReopenOnSIGHUP {
+		w.sighup = make(chan os.Signal, 1)
+		signal.Notify(w.sighup, syscall.SIGHUP)
+		go w.watchSIGHUP()
+	}
+	return w, nil
+}
+
+func (w *Writer) watchSIGHUP() {
+	for {
+		select {
+		case <-w.sighup:
+			w.Reopen()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// open opens the file and, on success, closes the current one.
+// The caller holds mu
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.cfg.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.cfg.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.cfg.Perm)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if w.f != nil {
+		w.f.Close()
+	}
+	w.f = f
+	w.size = info.Size()
+	w.openedAt = w.now()
+	return nil
+}
+
+// Write writes p to the file, rotating it before when p would exceed
+// MaxSize or the interval ended
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.needsRotate(len(p)) {
+		if err := w.rotate(); err != nil && w.cfg.ErrorHandler != nil {
+			w.cfg.ErrorHandler(err)
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) needsRotate(n int) bool {
+	if w.cfg.MaxSize > 0 && w.size > 0 && w.size+int64(n) > w.cfg.MaxSize {
+		return true
+	}
+	if w.cfg.Interval > 0 {
+		return !w.now().Truncate(w.cfg.Interval).Equal(w.openedAt.Truncate(w.cfg.Interval))
+	}
+	return false
+}
+
+// Rotate moves the file to a backup and opens a new one
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate is Rotate with mu held. The current file is closed only when
+// the new one is open, on failure the lines keep going to the current file
+func (w *Writer) rotate() error {
+	backup := w.backupName()
+	if err := os.Rename(w.cfg.Filename, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		// the current file keeps its name
+		os.Rename(backup, w.cfg.Filename)
+		return err
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.mill(backup)
+	}()
+	return nil
+}
+
+// backupName returns a name not in use for the current file. With an
+// Interval it's the start of the interval of the file, otherwise the time
+// of the rotation. The next backups with the same time get the suffix
+// _1, _2 and so on, after the highest one on disk
+func (w *Writer) backupName() string {
+	t := w.now()
+	if w.cfg.Interval > 0 {
+		t = w.openedAt.Truncate(w.cfg.Interval)
+	}
+	stamp := t.Format(backupTimeFormat)
+	if stamp != w.lastStamp {
+		w.lastStamp, w.lastN = stamp, -1
+		backups, _ := w.backups()
+		for _, b := range backups {
+			if b.t.Equal(t) && b.n > w.lastN {
+				w.lastN = b.n
+			}
+		}
+	}
+	prefix, ext := w.prefixExt()
+	for {
+		w.lastN++
+		backup := prefix + stamp + ext
+		if w.lastN > 0 {
+			backup = prefix + stamp + "_" + strconv.Itoa(w.lastN) + ext
+		}
+		if !exists(backup) && !exists(backup+".gz") {
+			return backup
+		}
+	}
+}
+
+// prefixExt returns the start of the backup names and the extension of the file
+func (w *Writer) prefixExt() (string, string) {
+	ext := filepath.Ext(w.cfg.Filename)
+	return strings.TrimSuffix(w.cfg.Filename, ext) + "-", ext
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// mill compresses backup, when enabled, and removes the old backups
+func (w *Writer) mill(backup string) {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+	if w.cfg.Compress {
+		if err := compress(backup); err == nil {
+			os.Remove(backup)
+		}
+	}
+	if w.cfg.MaxBackups <= 0 {
+		return
+	}
+	backups, err := w.Backups()
+	if err != nil || len(backups) <= w.cfg.MaxBackups {
+		return
+	}
+	for _, b := range backups[:len(backups)-w.cfg.MaxBackups] {
+		os.Remove(b)
+	}
+}
+
+// Backups returns the rotated files, from the oldest to the newest
+func (w *Writer) Backups() ([]string, error) {
+	backups, err := w.backups()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(backups))
+	for i, b := range backups {
+		names[i] = b.name
+	}
+	return names, nil
+}
+
+// backup is a rotated file with the time and the suffix of its name
+type backup struct {
+	name string
+	t    time.Time
+	n    int
+}
+
+// backups returns the rotated files sorted by time and suffix
+func (w *Writer) backups() ([]backup, error) {
+	prefix, ext := w.prefixExt()
+	entries, err := os.ReadDir(filepath.Dir(w.cfg.Filename))
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := filepath.Join(filepath.Dir(w.cfg.Filename), e.Name())
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)[len(prefix):]
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, stamp[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		n := 0
+		if suffix := stamp[len(backupTimeFormat):]; suffix != "" {
+			if n, err = strconv.Atoi(strings.TrimPrefix(suffix, "_")); err != nil || suffix[0] != '_' {
+				continue
+			}
+		}
+		backups = append(backups, backup{name, t, n})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].t.Equal(backups[j].t) {
+			return backups[i].t.Before(backups[j].t)
+		}
+		return backups[i].n < backups[j].n
+	})
+	return backups, nil
+}
+
+func compress(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name + ".gz")
+		}
+	}()
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Reopen opens the file again, without rotating it. When it fails the
+// lines keep going to the current file
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	return w.open()
+}
+
+// Sync commits the file to the disk
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.f.Sync()
+}
+
+// Close closes the file and waits the background compression
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.sighup != nil {
+		signal.Stop(w.sighup)
+	}
+	close(w.done)
+	err := w.f.Close()
+	w.mu.Unlock()
+	w.wg.Wait()
+	return err
+}
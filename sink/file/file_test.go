@@ -0,0 +1,194 @@
+package file
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axpira/goplogjson"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestWriterRotateBySize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logs", "app.log")
+	w, err := New(Config{Filename: name, MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2021, 9, 26, 7, 57, 36, 0, time.UTC)
+	w.now = func() time.Time {
+		ts = ts.Add(time.Second)
+		return ts
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, name); got != "fourth\n" {
+		t.Errorf("want current file with fourth and got %q", got)
+	}
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("want 2 backups and got %v", backups)
+	}
+	if got := readFile(t, backups[0]) + readFile(t, backups[1]); got != "second\nthird\n" {
+		t.Errorf("want the newest backups and got %q", got)
+	}
+	if _, err := w.Write([]byte("closed")); err != ErrClosed {
+		t.Errorf("want %v and got %v", ErrClosed, err)
+	}
+}
+
+func TestWriterRotateByTime(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(Config{Filename: name, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	now := time.Date(2021, 9, 26, 7, 57, 36, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	w.openedAt = now
+	w.Write([]byte("first\n"))
+	now = now.Add(time.Minute)
+	w.Write([]byte("same hour\n"))
+	now = now.Add(5 * time.Minute)
+	w.Write([]byte("next hour\n"))
+
+	backups, _ := w.Backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], "app-20210926T070000.000.log") {
+		t.Fatalf("want 1 backup and got %v", backups)
+	}
+	if got := readFile(t, backups[0]); got != "first\nsame hour\n" {
+		t.Errorf("wrong backup %q", got)
+	}
+	if got := readFile(t, name); got != "next hour\n" {
+		t.Errorf("wrong file %q", got)
+	}
+}
+
+func TestWriterBackupOrder(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(Config{Filename: name, Interval: time.Hour, MaxSize: 5, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 9, 26, 7, 57, 36, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	w.openedAt = now
+	// every write rotates by size in the same interval, so the backups
+	// have the same time
+	for i := 0; i < 12; i++ {
+		w.Write([]byte("line" + strconv.Itoa(i) + "\n"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := w.Backups()
+	if len(backups) != 2 || !strings.HasSuffix(backups[0], "app-20210926T070000.000_9.log") ||
+		!strings.HasSuffix(backups[1], "app-20210926T070000.000_10.log") {
+		t.Fatalf("want the 2 newest backups and got %v", backups)
+	}
+	if got := readFile(t, backups[0]) + readFile(t, backups[1]); got != "line9\nline10\n" {
+		t.Errorf("wrong backups %q", got)
+	}
+}
+
+func TestWriterRotateFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	name := filepath.Join(dir, "app.log")
+	var errs []error
+	w, err := New(Config{Filename: name, MaxSize: 10, ErrorHandler: func(err error) { errs = append(errs, err) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("first\n"))
+	// neither rename nor open work when the directory is a file
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err == nil {
+		t.Error("want reopen error")
+	}
+	if err := w.Rotate(); err == nil {
+		t.Error("want rotate error")
+	}
+	if _, err := w.Write([]byte("second line\n")); err != nil {
+		t.Errorf("want write to the current file and got %v", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("want rotate error reported and got %v", errs)
+	}
+}
+
+func TestWriterCompress(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(Config{Filename: name, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("compressed\n"))
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := w.Backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], ".log.gz") {
+		t.Fatalf("want 1 compressed backup and got %v", backups)
+	}
+	f, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(gz)
+	if string(b) != "compressed\n" {
+		t.Errorf("wrong backup %q", b)
+	}
+}
+
+func TestWriterWithOutput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(Config{Filename: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := goplogjson.New(goplogjson.WithOutput(w))
+	l.Info("test")
+	if err := l.(goplogjson.Syncer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, name); !strings.Contains(got, `"msg":"test"`) {
+		t.Errorf("wrong file %q", got)
+	}
+}
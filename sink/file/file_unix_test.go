@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriterReopenOnSIGHUP(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(Config{Filename: name, ReopenOnSIGHUP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("before\n"))
+	if err := os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(name); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file not reopened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Write([]byte("after\n"))
+	if got := readFile(t, name); got != "after\n" {
+		t.Errorf("wrong file %q", got)
+	}
+}
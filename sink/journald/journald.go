@@ -0,0 +1,244 @@
+//go:build linux
+// +build linux
+
+// Package journald provides a writer sending each line to systemd-journald
+// with the native protocol, to be used with goplogjson.WithOutput
+package journald
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/axpira/gop/log"
+	"github.com/axpira/goplogjson"
+	"github.com/axpira/goplogjson/sink/syslog"
+)
+
+// DefaultAddr is the socket of the journald native protocol
+const DefaultAddr = "/run/systemd/journal/socket"
+
+// maxKeyLen is the maximum size of a journal field name
+const maxKeyLen = 64
+
+// ErrClosed is returned when writing to a closed Writer
+var ErrClosed = errors.New("journald: writer closed")
+
+// Config defines the journald socket and the fields of the entries
+type Config struct {
+	// Addr is the socket of journald, DefaultAddr when empty
+	Addr string
+	// MessageFieldName is the field sent as MESSAGE,
+	// goplogjson.MessageFieldName when empty
+	MessageFieldName string
+	// Identifier is the SYSLOG_IDENTIFIER of the entries, the name of
+	// the program when empty
+	Identifier string
+}
+
+// Writer sends each line as a journal entry, each top level field becomes
+// an upper case journal field and the level of the line the PRIORITY.
+// Entries over the datagram limit are sent in a memfd. It's safe for
+// concurrent use
+type Writer struct {
+	cfg  Config
+	mu   sync.Mutex
+	conn *net.UnixConn
+	buf  []byte
+}
+
+// New connects to the journald socket of cfg
+func New(cfg Config) (*Writer, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+	if cfg.MessageFieldName == "" {
+		cfg.MessageFieldName = goplogjson.MessageFieldName
+	}
+	if cfg.Identifier == "" {
+		cfg.Identifier = filepath.Base(os.Args[0])
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: cfg.Addr, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{cfg: cfg, conn: conn, buf: make([]byte, 0, 1024)}, nil
+}
+
+// Write sends p with the info priority
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteLevel(log.InfoLevel, p)
+}
+
+// WriteLevel sends p with the PRIORITY of lv
+func (w *Writer) WriteLevel(lv log.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return 0, ErrClosed
+	}
+	w.buf = w.appendEntry(w.buf[:0], lv, p)
+	_, err := w.conn.Write(w.buf)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = w.sendFd(w.buf)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendEntry appends the journal fields of the JSON line p
+func (w *Writer) appendEntry(dst []byte, lv log.Level, p []byte) []byte {
+	dst = appendField(dst, []byte("PRIORITY"), strconv.AppendInt(nil, int64(syslog.Severity(lv)), 10))
+	dst = appendField(dst, []byte("SYSLOG_IDENTIFIER"), []byte(w.cfg.Identifier))
+	var key [maxKeyLen]byte
+	goplogjson.RangeFields(p, func(k, v []byte) {
+		if string(k) == w.cfg.MessageFieldName {
+			dst = appendField(dst, []byte("MESSAGE"), v)
+			return
+		}
+		if name := fieldName(key[:0], k); len(name) > 0 {
+			dst = appendField(dst, name, v)
+		}
+	})
+	return dst
+}
+
+// fieldName appends k as a journal field name: upper case letters, digits
+// and underscores, not starting with an underscore or a digit
+func fieldName(dst, k []byte) []byte {
+	for _, c := range k {
+		switch {
+		case len(dst) == maxKeyLen:
+			return dst
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+			if len(dst) == 0 {
+				dst = append(dst, 'X')
+			}
+		case len(dst) == 0:
+			continue
+		default:
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// appendField appends a field, values with new lines use the binary format
+func appendField(dst, key, value []byte) []byte {
+	dst = append(dst, key...)
+	for _, c := range value {
+		if c == '\n' {
+			var size [8]byte
+			binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+			dst = append(dst, '\n')
+			dst = append(dst, size[:]...)
+			dst = append(dst, value...)
+			return append(dst, '\n')
+		}
+	}
+	dst = append(dst, '=')
+	dst = append(dst, value...)
+	return append(dst, '\n')
+}
+
+// sendFd sends the entry in a sealed memfd, used when it's over the
+// datagram limit
+func (w *Writer) sendFd(entry []byte) error {
+	f, err := memfd(entry)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	raw, err := w.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	werr := raw.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 0x409
+	// F_SEAL_SEAL, F_SEAL_SHRINK, F_SEAL_GROW and F_SEAL_WRITE
+	sealAll = 0x1 | 0x2 | 0x4 | 0x8
+)
+
+// sysMemfdCreate is the number of the memfd_create syscall, it's not
+// defined by the syscall package for every architecture
+func sysMemfdCreate() uintptr {
+	switch runtime.GOARCH {
+	case "amd64":
+		return 319
+	case "386":
+		return 356
+	case "arm":
+		return 385
+	case "arm64", "riscv64", "loong64":
+		return 279
+	case "ppc64", "ppc64le":
+		return 360
+	case "s390x":
+		return 350
+	}
+	return 0
+}
+
+// memfd returns a sealed memfd with data
+func memfd(data []byte) (*os.File, error) {
+	nr := sysMemfdCreate()
+	if nr == 0 {
+		return nil, errors.New("journald: memfd_create not supported on " + runtime.GOARCH)
+	}
+	name, err := syscall.BytePtrFromString("journald")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(nr, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	f := os.NewFile(fd, "journald")
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, sealAll); errno != 0 {
+		f.Close()
+		return nil, errno
+	}
+	return f, nil
+}
+
+// Close closes the connection
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
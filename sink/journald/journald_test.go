@@ -0,0 +1,125 @@
+//go:build linux
+// +build linux
+
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/axpira/gop/log"
+	"github.com/axpira/goplogjson"
+)
+
+// listen returns a unixgram socket standing in for journald
+func listen(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	addr := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, addr
+}
+
+// readEntry reads a datagram or, when it carries a file descriptor, the
+// content of the file
+func readEntry(t *testing.T, conn *net.UnixConn) []byte {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oobn == 0 {
+		return buf[:n]
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "memfd")
+	defer f.Close()
+	// the offset is shared with the writer, journald maps the file
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWriter(t *testing.T) {
+	conn, addr := listen(t)
+	w, err := New(Config{Addr: addr, Identifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := goplogjson.DefaultEncoderConfig()
+	cfg.TimestampDisabled = true
+	l := goplogjson.New(goplogjson.WithOutput(w), goplogjson.WithEncoderConfig(cfg))
+	defer l.(goplogjson.Syncer).Close()
+
+	l.Wrn(l.NewFieldBuilder().
+		Msg("multi\nline").
+		Str("dd.trace_id", "1").
+		Int("_private", 2).
+		Bool("1st", true).
+		Dict("user", l.NewFieldBuilder().Str("id", "u1")))
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len("multi\nline")))
+	want := "PRIORITY=4\nSYSLOG_IDENTIFIER=app\n" +
+		"MESSAGE\n" + string(size[:]) + "multi\nline\n" +
+		"DD_TRACE_ID=1\nPRIVATE=2\nX1ST=true\nUSER={\"id\":\"u1\"}\nLEVEL=warn\n"
+	if got := string(readEntry(t, conn)); got != want {
+		t.Errorf("\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestWriterMemfd(t *testing.T) {
+	conn, addr := listen(t)
+	w, err := New(Config{Addr: addr, Identifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	big := strings.Repeat("x", 1<<20)
+	if _, err := w.WriteLevel(log.ErrorLevel, []byte(`{"msg":"`+big+`"}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := "PRIORITY=3\nSYSLOG_IDENTIFIER=app\nMESSAGE=" + big + "\n"
+	if got := readEntry(t, conn); !bytes.Equal(got, []byte(want)) {
+		t.Errorf("want entry of %d bytes and got %d", len(want), len(got))
+	}
+	if _, err := w.Write([]byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if _, err := w.Write([]byte("{}")); err != ErrClosed {
+		t.Errorf("want %v and got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,452 @@
+// Package opensearch provides a writer indexing the lines in Elasticsearch
+// or OpenSearch with the _bulk API, to be used with goplogjson.WithOutput
+package opensearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/axpira/goplogjson"
+)
+
+var (
+	// ErrClosed is returned when writing to a closed Writer
+	ErrClosed = errors.New("opensearch: writer closed")
+	// ErrTooManyRequests is returned when the server still answers 429
+	// after the retries
+	ErrTooManyRequests = errors.New("opensearch: too many requests")
+)
+
+// Config defines the server, the index and how the lines are batched
+type Config struct {
+	// URL is the address of the server, like http://localhost:9200
+	URL string
+	// Index is the index of the lines, the time of the line replaces
+	// %Y, %m, %d and %H, like logs-%Y.%m.%d. "logs" when empty
+	Index string
+	// TimeFieldName and TimeFormat define the time of the line,
+	// goplogjson.TimestampFieldName and TimestampFormat when empty.
+	// Lines without it use the current time
+	TimeFieldName string
+	TimeFormat    string
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+	// Header is added to the requests, like Authorization
+	Header http.Header
+	// BatchSize is the size in bytes that sends a request, 1MiB when 0
+	BatchSize int
+	// FlushInterval sends the lines not sent yet, 1s when 0
+	FlushInterval time.Duration
+	// MaxBuffer limits the bytes waiting to be sent, 4 times BatchSize
+	// when 0. Lines over the limit are dropped
+	MaxBuffer int
+	// MaxRetries is the number of retries of the documents rejected with
+	// 429, 3 when 0
+	MaxRetries int
+	// MinBackoff and MaxBackoff limit the time between the retries,
+	// 100ms and 10s when 0
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ErrorHandler is called with the errors of the requests and of the
+	// documents, as *ItemError
+	ErrorHandler func(error)
+}
+
+// ItemError is a document rejected by the server
+type ItemError struct {
+	Index  string
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("opensearch: index %s: %d %s: %s", e.Index, e.Status, e.Type, e.Reason)
+}
+
+// Stats are the counters of documents of a Writer
+type Stats struct {
+	// Indexed are the documents accepted by the server
+	Indexed uint64
+	// Failed are the documents rejected by the server or not sent
+	Failed uint64
+	// Dropped are the documents dropped because the buffer was full
+	Dropped uint64
+}
+
+// Writer indexes each line as a document, it's safe for concurrent use
+type Writer struct {
+	// accessed atomically, first to be 64-bit aligned
+	indexed uint64
+	failed  uint64
+	dropped uint64
+
+	cfg Config
+	url string
+	now func() time.Time
+
+	mu           sync.Mutex
+	cur          *batch
+	pending      []*batch
+	pendingBytes int
+	closed       bool
+
+	wake    chan struct{}
+	flushes chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// batch is the body of a _bulk request, docs are the ranges of body with
+// the action and the source of each document
+type batch struct {
+	body []byte
+	docs [][2]int
+}
+
+// New returns a Writer indexing in the server of cfg
+func New(cfg Config) (*Writer, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("opensearch: empty URL")
+	}
+	if cfg.Index == "" {
+		cfg.Index = "logs"
+	}
+	if cfg.TimeFieldName == "" {
+		cfg.TimeFieldName = goplogjson.TimestampFieldName
+	}
+	if cfg.TimeFormat == "" {
+		cfg.TimeFormat = goplogjson.TimestampFormat
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 1 << 20
+	}
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxBuffer == 0 {
+		cfg.MaxBuffer = 4 * cfg.BatchSize
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = 10 * time.Second
+	}
+	w := &Writer{
+		cfg:     cfg,
+		url:     strings.TrimSuffix(cfg.URL, "/") + "/_bulk",
+		now:     time.Now,
+		cur:     &batch{},
+		wake:    make(chan struct{}, 1),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write adds each line of p as a document to the current batch, it never
+// waits the network
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if w.pendingBytes+len(w.cur.body)+len(line) > w.cfg.MaxBuffer {
+			atomic.AddUint64(&w.dropped, 1)
+			continue
+		}
+		w.cur.add(w.index(line), line)
+	}
+	if len(w.cur.body) >= w.cfg.BatchSize {
+		w.cut()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// add appends the index action and the document
+func (b *batch) add(index string, doc []byte) {
+	start := len(b.body)
+	b.body = append(b.body, `{"index":{"_index":`...)
+	idx, _ := json.Marshal(index)
+	b.body = append(b.body, idx...)
+	b.body = append(b.body, "}}\n"...)
+	b.body = append(b.body, doc...)
+	b.body = append(b.body, '\n')
+	b.docs = append(b.docs, [2]int{start, len(b.body)})
+}
+
+// index returns the index of the line, from the pattern and its time
+func (w *Writer) index(line []byte) string {
+	if !strings.Contains(w.cfg.Index, "%") {
+		return w.cfg.Index
+	}
+	var t time.Time
+	goplogjson.RangeFields(line, func(key, value []byte) {
+		if t.IsZero() && string(key) == w.cfg.TimeFieldName {
+			t, _ = time.Parse(w.cfg.TimeFormat, string(value))
+		}
+	})
+	if t.IsZero() {
+		t = w.now()
+	}
+	return formatIndex(w.cfg.Index, t.UTC())
+}
+
+// formatIndex replaces %Y, %m, %d, %H and %% of pattern with t
+func formatIndex(pattern string, t time.Time) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			sb.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&sb, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", t.Month())
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(pattern[i])
+		}
+	}
+	return sb.String()
+}
+
+// cut moves the current batch to the pending ones, the caller holds mu
+func (w *Writer) cut() {
+	if len(w.cur.docs) == 0 {
+		return
+	}
+	w.pending = append(w.pending, w.cur)
+	w.pendingBytes += len(w.cur.body)
+	w.cur = &batch{}
+}
+
+func (w *Writer) takePending() []*batch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cut()
+	batches := w.pending
+	w.pending = nil
+	w.pendingBytes = 0
+	return batches
+}
+
+// Stats returns the counters of the Writer
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Indexed: atomic.LoadUint64(&w.indexed),
+		Failed:  atomic.LoadUint64(&w.failed),
+		Dropped: atomic.LoadUint64(&w.dropped),
+	}
+}
+
+// Flush sends the lines written so far and returns the first error of
+// the requests or of the documents
+func (w *Writer) Flush() error {
+	reply := make(chan error, 1)
+	select {
+	case w.flushes <- reply:
+		return <-reply
+	case <-w.stopped:
+		return ErrClosed
+	}
+}
+
+// Close sends the lines written so far
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.done)
+	<-w.stopped
+	return nil
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.wake:
+		case <-ticker.C:
+		case reply := <-w.flushes:
+			reply <- w.ship()
+			continue
+		case <-w.done:
+			w.ship()
+			return
+		}
+		w.ship()
+	}
+}
+
+func (w *Writer) ship() error {
+	var first error
+	for _, b := range w.takePending() {
+		if err := w.send(b); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// send posts b, retrying the documents rejected with 429.
+// It returns the first error that was not retried
+func (w *Writer) send(b *batch) error {
+	backoff := w.cfg.MinBackoff
+	var first error
+	for retry := 0; ; retry++ {
+		retryable, err := w.post(b, retry == w.cfg.MaxRetries)
+		if err != nil && err != ErrTooManyRequests && first == nil {
+			first = err
+		}
+		if retryable == nil {
+			if first == nil {
+				first = err
+			}
+			return first
+		}
+		b = retryable
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > w.cfg.MaxBackoff {
+			backoff = w.cfg.MaxBackoff
+		}
+	}
+}
+
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+type bulkItem struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// post sends b and returns the batch of the documents to retry, unless
+// last is set. err is the first error of the request or of the documents
+func (w *Writer) post(b *batch, last bool) (retry *batch, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(b.body))
+	if err != nil {
+		return nil, w.fail(b, err)
+	}
+	for k, v := range w.cfg.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := w.cfg.Client.Do(req)
+	if err != nil {
+		return nil, w.fail(b, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		io.Copy(io.Discard, resp.Body)
+		if last {
+			return nil, w.fail(b, ErrTooManyRequests)
+		}
+		return b, ErrTooManyRequests
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, w.fail(b, fmt.Errorf("opensearch: bulk status %d: %s", resp.StatusCode, bytes.TrimSpace(msg)))
+	}
+	var br bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&br); err != nil {
+		return nil, w.fail(b, err)
+	}
+	if !br.Errors {
+		atomic.AddUint64(&w.indexed, uint64(len(b.docs)))
+		return nil, nil
+	}
+	for i, item := range br.Items {
+		if i >= len(b.docs) {
+			break
+		}
+		for _, it := range item {
+			switch {
+			case it.Status < 300:
+				atomic.AddUint64(&w.indexed, 1)
+			case it.Status == http.StatusTooManyRequests && !last:
+				if retry == nil {
+					retry = &batch{}
+				}
+				doc := b.body[b.docs[i][0]:b.docs[i][1]]
+				start := len(retry.body)
+				retry.body = append(retry.body, doc...)
+				retry.docs = append(retry.docs, [2]int{start, len(retry.body)})
+			default:
+				ie := &ItemError{Index: it.Index, Status: it.Status}
+				if it.Error != nil {
+					ie.Type, ie.Reason = it.Error.Type, it.Error.Reason
+				}
+				atomic.AddUint64(&w.failed, 1)
+				w.handleError(ie)
+				if err == nil {
+					err = ie
+				}
+			}
+		}
+	}
+	if retry != nil && err == nil {
+		err = ErrTooManyRequests
+	}
+	return retry, err
+}
+
+// fail counts the documents of b as failed and reports err
+func (w *Writer) fail(b *batch, err error) error {
+	atomic.AddUint64(&w.failed, uint64(len(b.docs)))
+	w.handleError(err)
+	return err
+}
+
+func (w *Writer) handleError(err error) {
+	if w.cfg.ErrorHandler != nil {
+		w.cfg.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,200 @@
+package opensearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/axpira/goplogjson"
+)
+
+// bulkServer is a stand-in for the _bulk API, status returns the status
+// of each document, by its content, for each request
+type bulkServer struct {
+	mu       sync.Mutex
+	requests int
+	docs     []string
+	indexes  []string
+	status   func(request int, doc string) int
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" ||
+		r.Header.Get("Authorization") != "Basic test" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if s.status != nil && s.status(s.requests, "") == http.StatusTooManyRequests {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+		return
+	}
+	sc := bufio.NewScanner(r.Body)
+	var items []string
+	errors := false
+	for sc.Scan() {
+		var action struct {
+			Index struct {
+				Index string `json:"_index"`
+			} `json:"index"`
+		}
+		json.Unmarshal(sc.Bytes(), &action)
+		sc.Scan()
+		doc := sc.Text()
+		status := 201
+		if s.status != nil {
+			if st := s.status(s.requests, doc); st != 0 {
+				status = st
+			}
+		}
+		if status >= 300 {
+			errors = true
+			items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"status":%d,"error":{"type":"mapper_parsing_exception","reason":"bad doc"}}}`,
+				action.Index.Index, status))
+			continue
+		}
+		s.docs = append(s.docs, doc)
+		s.indexes = append(s.indexes, action.Index.Index)
+		items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"status":%d}}`, action.Index.Index, status))
+	}
+	fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, errors, strings.Join(items, ","))
+}
+
+func newTestWriter(t *testing.T, s *bulkServer, cfg Config) *Writer {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	cfg.Header = http.Header{"Authorization": {"Basic test"}}
+	cfg.MinBackoff = time.Millisecond
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = time.Hour
+	}
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestWriterIndexPattern(t *testing.T) {
+	s := &bulkServer{}
+	w := newTestWriter(t, s, Config{Index: "logs-%Y.%m.%d"})
+	w.now = func() time.Time { return time.Date(2021, 9, 27, 0, 0, 0, 0, time.UTC) }
+	cfg := goplogjson.DefaultEncoderConfig()
+	cfg.TimestampFunc = func() time.Time { return time.Date(2021, 9, 26, 7, 57, 36, 0, time.UTC) }
+	l := goplogjson.New(goplogjson.WithOutput(w), goplogjson.WithEncoderConfig(cfg))
+	l.Info("first")
+	w.Write([]byte(`{"msg":"no time"}` + "\n"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"logs-2021.09.26", "logs-2021.09.27"}
+	if fmt.Sprint(s.indexes) != fmt.Sprint(want) {
+		t.Errorf("want %v and got %v", want, s.indexes)
+	}
+	if len(s.docs) != 2 || !strings.Contains(s.docs[0], `"msg":"first"`) {
+		t.Errorf("wrong docs %v", s.docs)
+	}
+	if st := w.Stats(); st.Indexed != 2 || st.Failed != 0 {
+		t.Errorf("wrong stats %+v", st)
+	}
+}
+
+func TestWriterBatchSize(t *testing.T) {
+	s := &bulkServer{}
+	w := newTestWriter(t, s, Config{BatchSize: 50})
+	w.Write([]byte(`{"msg":"a long enough line"}` + "\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Stats().Indexed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("batch not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	s := &bulkServer{}
+	w := newTestWriter(t, s, Config{FlushInterval: 10 * time.Millisecond})
+	w.Write([]byte(`{"msg":"a"}` + "\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Stats().Indexed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("batch not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriterItemErrors(t *testing.T) {
+	s := &bulkServer{status: func(request int, doc string) int {
+		switch {
+		case doc == `{"msg":"bad"}`:
+			return http.StatusBadRequest
+		case doc == `{"msg":"busy"}` && request == 1:
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}}
+	var errs []error
+	w := newTestWriter(t, s, Config{ErrorHandler: func(err error) { errs = append(errs, err) }})
+	w.Write([]byte(`{"msg":"ok"}` + "\n" + `{"msg":"bad"}` + "\n" + `{"msg":"busy"}` + "\n"))
+	err := w.Flush()
+	ie, ok := err.(*ItemError)
+	if !ok || ie.Status != http.StatusBadRequest || ie.Type != "mapper_parsing_exception" {
+		t.Fatalf("want item error and got %v", err)
+	}
+	if len(errs) != 1 || errs[0] != err {
+		t.Errorf("want error handler called once and got %v", errs)
+	}
+	want := []string{`{"msg":"ok"}`, `{"msg":"busy"}`}
+	if fmt.Sprint(s.docs) != fmt.Sprint(want) || s.requests != 2 {
+		t.Errorf("want %v in 2 requests and got %v in %d", want, s.docs, s.requests)
+	}
+	if st := w.Stats(); st.Indexed != 2 || st.Failed != 1 {
+		t.Errorf("wrong stats %+v", st)
+	}
+}
+
+func TestWriterTooManyRequests(t *testing.T) {
+	s := &bulkServer{status: func(request int, doc string) int {
+		if doc == "" && request <= 2 {
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}}
+	w := newTestWriter(t, s, Config{})
+	w.Write([]byte(`{"msg":"a"}` + "\n"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.requests != 3 || len(s.docs) != 1 {
+		t.Errorf("want doc indexed on the third request and got %d requests %v", s.requests, s.docs)
+	}
+
+	s.status = func(int, string) int { return http.StatusTooManyRequests }
+	w.Write([]byte(`{"msg":"b"}` + "\n"))
+	if err := w.Flush(); err != ErrTooManyRequests {
+		t.Errorf("want %v and got %v", ErrTooManyRequests, err)
+	}
+	if st := w.Stats(); st.Indexed != 1 || st.Failed != 1 {
+		t.Errorf("wrong stats %+v", st)
+	}
+}
+
+func TestFormatIndex(t *testing.T) {
+	got := formatIndex("logs-%Y.%m.%d-%H-%%-%x", time.Date(2021, 9, 6, 7, 0, 0, 0, time.UTC))
+	if want := "logs-2021.09.06-07-%-%x"; got != want {
+		t.Errorf("want %s and got %s", want, got)
+	}
+}
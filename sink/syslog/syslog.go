@@ -0,0 +1,312 @@
+// Package syslog provides a writer sending each line to syslog, with the
+// severity of the level of the line, to be used with goplogjson.WithOutput
+package syslog
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axpira/gop/log"
+)
+
+// Format is the header added to the lines
+type Format uint8
+
+const (
+	// RFC5424 is the syslog protocol header
+	RFC5424 Format = iota
+	// RFC3164 is the BSD syslog header
+	RFC3164
+)
+
+// Facility is the syslog facility of the lines
+type Facility uint8
+
+// The facilities defined by RFC 5424. Kern is reserved to the kernel
+// and can't be selected, a zero Config.Facility is User
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	Lpr
+	News
+	Uucp
+	Cron
+	Authpriv
+	Ftp
+	Local0 Facility = iota + 4
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+// ErrClosed is returned when writing to a closed Writer
+var ErrClosed = errors.New("syslog: writer closed")
+
+// Config defines the syslog server and the header of the lines
+type Config struct {
+	// Network is unixgram, udp, tcp or unix. When empty the local syslog
+	// socket is used. The lines are framed on the stream networks, tcp,
+	// tcp4, tcp6 and unix
+	Network string
+	// Addr is the address of the server, or the path of the socket
+	Addr string
+	// Format is the header of the lines
+	Format Format
+	// Facility is the facility of the lines, User when 0 (Kern)
+	Facility Facility
+	// Hostname is the host of the lines, os.Hostname when empty.
+	// Characters other than printable ASCII are replaced by '_' and it's
+	// cut to 255 bytes, as RFC 5424 requires
+	Hostname string
+	// AppName is the app name (tag in RFC 3164) of the lines, the name
+	// of the program when empty. It's sanitized like Hostname and cut
+	// to 48 bytes
+	AppName string
+	// DialTimeout limits each connect to the server, 5s when 0
+	DialTimeout time.Duration
+	// MinBackoff and MaxBackoff limit the time between the reconnects,
+	// 100ms and 30s when 0
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// localSockets are tried, in order, when Config.Network is empty
+var localSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Writer sends lines to syslog, over stream networks they are framed
+// with octet counting. It's safe for concurrent use
+type Writer struct {
+	cfg Config
+	pid string
+	now func() time.Time
+
+	mu       sync.Mutex
+	conn     net.Conn
+	buf      []byte
+	backoff  time.Duration
+	nextDial time.Time
+	closed   bool
+}
+
+// New connects to the syslog server of cfg
+func New(cfg Config) (*Writer, error) {
+	if cfg.Facility == 0 {
+		cfg.Facility = User
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	cfg.Hostname = headerField(cfg.Hostname, 255)
+	if cfg.AppName == "" {
+		cfg.AppName = filepath.Base(os.Args[0])
+	}
+	cfg.AppName = headerField(cfg.AppName, 48)
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	w := &Writer{
+		cfg: cfg,
+		pid: strconv.Itoa(os.Getpid()),
+		now: time.Now,
+		buf: make([]byte, 0, 500),
+	}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// headerField returns s with the characters other than printable ASCII
+// replaced by '_' and cut to max bytes, "-" (nil value) when it's empty
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < '!' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// dial connects to the server, the caller holds mu
+func (w *Writer) dial() error {
+	dialer := &net.Dialer{Timeout: w.cfg.DialTimeout}
+	if w.cfg.Network != "" {
+		conn, err := dialer.Dial(w.cfg.Network, w.cfg.Addr)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		return nil
+	}
+	var err error
+	for _, addr := range localSockets {
+		var conn net.Conn
+		if conn, err = dialer.Dial("unixgram", addr); err == nil {
+			w.conn = conn
+			return nil
+		}
+	}
+	return err
+}
+
+// Severity returns the syslog severity of lv
+func Severity(lv log.Level) int {
+	switch lv {
+	case log.TraceLevel, log.DebugLevel:
+		return 7
+	case log.WarnLevel:
+		return 4
+	case log.ErrorLevel:
+		return 3
+	case log.FatalLevel:
+		return 2
+	case log.PanicLevel:
+		return 1
+	}
+	return 6
+}
+
+// Write sends p with the info severity
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteLevel(log.InfoLevel, p)
+}
+
+// WriteLevel sends p with the severity of lv. When the connection is
+// lost it reconnects, waiting longer after each failure
+func (w *Writer) WriteLevel(lv log.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	w.buf = w.appendMessage(w.buf[:0], lv, p)
+	if w.conn != nil {
+		if _, err := w.conn.Write(w.buf); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.reconnect(); err != nil {
+		return 0, err
+	}
+	if _, err := w.conn.Write(w.buf); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// reconnect dials the server when the backoff time passed
+func (w *Writer) reconnect() error {
+	now := w.now()
+	if now.Before(w.nextDial) {
+		return errors.New("syslog: not connected, waiting to reconnect")
+	}
+	if err := w.dial(); err != nil {
+		if w.backoff == 0 {
+			w.backoff = w.cfg.MinBackoff
+		} else if w.backoff *= 2; w.backoff > w.cfg.MaxBackoff {
+			w.backoff = w.cfg.MaxBackoff
+		}
+		w.nextDial = now.Add(w.backoff)
+		return err
+	}
+	w.backoff = 0
+	w.nextDial = time.Time{}
+	return nil
+}
+
+// appendMessage appends p, without the trailing new line, with the
+// header and the framing of the connection
+func (w *Writer) appendMessage(dst []byte, lv log.Level, p []byte) []byte {
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		p = p[:len(p)-1]
+	}
+	start := len(dst)
+	dst = w.appendHeader(dst, lv)
+	dst = append(dst, p...)
+	if !isStream(w.cfg.Network) {
+		return dst
+	}
+	// octet counting, RFC 6587
+	var frame [20]byte
+	prefix := append(strconv.AppendInt(frame[:0], int64(len(dst)-start), 10), ' ')
+	dst = append(dst, prefix...)
+	copy(dst[start+len(prefix):], dst[start:len(dst)-len(prefix)])
+	copy(dst[start:], prefix)
+	return dst
+}
+
+// isStream reports if network has no message boundaries, so the lines
+// must be framed
+func isStream(network string) bool {
+	return strings.HasPrefix(network, "tcp") || network == "unix"
+}
+
+func (w *Writer) appendHeader(dst []byte, lv log.Level) []byte {
+	dst = append(dst, '<')
+	dst = strconv.AppendInt(dst, int64(w.cfg.Facility)*8+int64(Severity(lv)), 10)
+	dst = append(dst, '>')
+	if w.cfg.Format == RFC3164 {
+		dst = w.now().AppendFormat(dst, time.Stamp)
+		dst = append(dst, ' ')
+		dst = append(dst, w.cfg.Hostname...)
+		dst = append(dst, ' ')
+		dst = append(dst, w.cfg.AppName...)
+		dst = append(dst, '[')
+		dst = append(dst, w.pid...)
+		return append(dst, "]: "...)
+	}
+	dst = append(dst, "1 "...)
+	dst = w.now().AppendFormat(dst, "2006-01-02T15:04:05.000000Z07:00")
+	dst = append(dst, ' ')
+	dst = append(dst, w.cfg.Hostname...)
+	dst = append(dst, ' ')
+	dst = append(dst, w.cfg.AppName...)
+	dst = append(dst, ' ')
+	dst = append(dst, w.pid...)
+	return append(dst, " - - "...)
+}
+
+// Close closes the connection
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
@@ -0,0 +1,229 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axpira/gop/log"
+	"github.com/axpira/goplogjson"
+)
+
+var testTime = time.Date(2021, 9, 26, 7, 57, 36, 123456000, time.UTC)
+
+func newTestWriter(t *testing.T, cfg Config) *Writer {
+	t.Helper()
+	cfg.Hostname = "host"
+	cfg.AppName = "app"
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.now = func() time.Time { return testTime }
+	w.pid = "42"
+	return w
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestWriterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w := newTestWriter(t, Config{Network: "udp", Addr: conn.LocalAddr().String(), Facility: Local0})
+	defer w.Close()
+
+	cfg := goplogjson.DefaultEncoderConfig()
+	cfg.TimestampDisabled = true
+	l := goplogjson.New(goplogjson.WithOutput(w), goplogjson.WithEncoderConfig(cfg))
+	l.Error("test", nil)
+	got := readPacket(t, conn)
+	want := `<131>1 2021-09-26T07:57:36.123456Z host app 42 - - {"msg":"test","level":"error"}`
+	if got != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestWriterUnixgramRFC3164(t *testing.T) {
+	dir, err := os.MkdirTemp("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip("unixgram not supported:", err)
+	}
+	defer conn.Close()
+	w := newTestWriter(t, Config{Network: "unixgram", Addr: addr, Format: RFC3164})
+	defer w.Close()
+
+	w.WriteLevel(log.WarnLevel, []byte("{\"msg\":\"test\"}\n"))
+	got := readPacket(t, conn)
+	want := `<12>Sep 26 07:57:36 host app[42]: {"msg":"test"}`
+	if got != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestWriterUnixStreamFramed(t *testing.T) {
+	dir, err := os.MkdirTemp("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Skip("unix not supported:", err)
+	}
+	defer ln.Close()
+	w := newTestWriter(t, Config{Network: "unix", Addr: addr, Facility: Kern})
+	defer w.Close()
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	w.WriteLevel(log.InfoLevel, []byte("first\n"))
+	w.WriteLevel(log.InfoLevel, []byte("second\n"))
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	for _, msg := range []string{"first", "second"} {
+		want := "<14>1 2021-09-26T07:57:36.123456Z host app 42 - - " + msg
+		want = strconv.Itoa(len(want)) + " " + want
+		buf := make([]byte, len(want))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != want {
+			t.Errorf("\nwant %s\ngot  %s", want, buf)
+		}
+	}
+}
+
+func TestWriterTCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+	w := newTestWriter(t, Config{Network: "tcp", Addr: ln.Addr().String()})
+	defer w.Close()
+
+	readFrame := func(r *bufio.Reader) string {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(size))
+		buf := make([]byte, n)
+		if _, err := r.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+		return string(buf)
+	}
+
+	w.WriteLevel(log.InfoLevel, []byte("first\n"))
+	c := <-conns
+	if got := readFrame(bufio.NewReader(c)); got != "<14>1 2021-09-26T07:57:36.123456Z host app 42 - - first" {
+		t.Errorf("wrong frame %q", got)
+	}
+	c.Close()
+
+	// the first writes after the server closed the connection may
+	// succeed, the reconnect happens when the write fails
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.WriteLevel(log.DebugLevel, []byte("second\n"))
+		select {
+		case c = <-conns:
+		case <-time.After(50 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("writer not reconnected")
+			}
+			w.mu.Lock()
+			w.nextDial = time.Time{}
+			w.mu.Unlock()
+			continue
+		}
+		break
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got := readFrame(bufio.NewReader(c)); !strings.HasSuffix(got, " second") {
+		t.Errorf("wrong frame %q", got)
+	}
+}
+
+func TestWriterBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWriter(t, Config{Network: "tcp", Addr: ln.Addr().String(), MinBackoff: time.Second, MaxBackoff: 3 * time.Second})
+	defer w.Close()
+	ln.Close()
+	w.conn.Close()
+	w.conn = nil
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		w.nextDial = time.Time{}
+		if _, err := w.Write([]byte("test")); err == nil {
+			t.Fatal("want error writing to a closed server")
+		}
+		if w.backoff != want {
+			t.Errorf("want backoff %v and got %v", want, w.backoff)
+		}
+	}
+	if _, err := w.Write([]byte("test")); err == nil || w.backoff != 3*time.Second {
+		t.Errorf("want write refused while waiting to reconnect and got %v", err)
+	}
+}
+
+func TestHeaderField(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"", 48, "-"},
+		{"my app", 48, "my_app"},
+		{"ação", 48, "a____o"},
+		{strings.Repeat("a", 60), 48, strings.Repeat("a", 48)},
+	}
+	for _, tt := range tests {
+		if got := headerField(tt.in, tt.max); got != tt.want {
+			t.Errorf("%q: want %q and got %q", tt.in, tt.want, got)
+		}
+	}
+}
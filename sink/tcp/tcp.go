@@ -0,0 +1,496 @@
+// Package tcp provides a writer shipping the lines to a TCP or TLS server
+// in batches, to be used with goplogjson.WithOutput. While the server is
+// down the batches are spooled to disk, or kept in memory, and replayed in
+// order on reconnect
+package tcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrClosed is returned when writing to a closed Writer
+	ErrClosed = errors.New("tcp: writer closed")
+	// ErrNotConnected is returned by Flush when it's waiting to reconnect
+	ErrNotConnected = errors.New("tcp: not connected, waiting to reconnect")
+)
+
+// spoolExt is the extension of the spooled batches
+const spoolExt = ".spool"
+
+// Config defines the server and how the lines are batched and spooled
+type Config struct {
+	// Addr is the address of the server
+	Addr string
+	// TLSConfig enables TLS when it's not nil
+	TLSConfig *tls.Config
+	// DialTimeout and WriteTimeout limit the connect and the write of a
+	// batch, 5s and 10s when 0
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	// BatchSize is the size in bytes that sends a batch, 64KiB when 0
+	BatchSize int
+	// FlushInterval sends the lines not sent yet and retries the
+	// connection, 1s when 0
+	FlushInterval time.Duration
+	// MaxBuffer limits the bytes kept in memory waiting to be sent or
+	// spooled, 4 times BatchSize when 0. Lines over the limit are dropped
+	MaxBuffer int
+	// MinBackoff and MaxBackoff limit the time between the reconnects,
+	// 100ms and 30s when 0
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// SpoolDir is the directory of the batches not sent. Batches found in
+	// it are sent by New, the ones that can't be read are renamed with the
+	// .corrupt extension
+	SpoolDir string
+	// MaxSpoolSize limits the bytes in SpoolDir, 64MiB when 0.
+	// Batches over the limit are dropped
+	MaxSpoolSize int64
+	// RetryTimeout is how long the batches not sent are kept in memory and
+	// retried, with the reconnect backoff, when SpoolDir is empty. 1m when
+	// 0. They count in MaxBuffer
+	RetryTimeout time.Duration
+	// ErrorHandler is called with the reason when batches are dropped or
+	// a spooled batch is set aside
+	ErrorHandler func(error)
+}
+
+// Stats are the counters of a Writer in bytes
+type Stats struct {
+	// Queued are the bytes waiting to be sent, in memory or spooled
+	Queued uint64
+	// Sent are the bytes written to the server
+	Sent uint64
+	// Dropped are the bytes dropped because a buffer was full
+	Dropped uint64
+}
+
+// Writer ships lines to a server, it's safe for concurrent use.
+// The delivery is at least once: a batch that failed in the middle of
+// the write is sent again
+type Writer struct {
+	// accessed atomically, first to be 64-bit aligned
+	queued  uint64
+	sent    uint64
+	dropped uint64
+
+	cfg Config
+
+	mu           sync.Mutex
+	cur          []byte
+	pending      [][]byte
+	pendingBytes int
+	retryBytes   int
+	closed       bool
+
+	wake    chan struct{}
+	flushes chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+
+	// used only by run
+	conn      net.Conn
+	backoff   time.Duration
+	nextDial  time.Time
+	seq       uint64
+	spoolSize int64
+	retry     []retryBatch
+}
+
+// retryBatch is a batch not sent kept in memory since the first failure
+type retryBatch struct {
+	b     []byte
+	since time.Time
+}
+
+// New returns a Writer shipping to the server of cfg, it connects in the
+// background so a server down doesn't fail New
+func New(cfg Config) (*Writer, error) {
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 64 << 10
+	}
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxBuffer == 0 {
+		cfg.MaxBuffer = 4 * cfg.BatchSize
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.MaxSpoolSize == 0 {
+		cfg.MaxSpoolSize = 64 << 20
+	}
+	if cfg.RetryTimeout == 0 {
+		cfg.RetryTimeout = time.Minute
+	}
+	w := &Writer{
+		cfg:     cfg,
+		wake:    make(chan struct{}, 1),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if cfg.SpoolDir != "" {
+		if err := w.openSpool(); err != nil {
+			return nil, err
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write adds p to the current batch, it never waits the network
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.pendingBytes+w.retryBytes+len(w.cur)+len(p) > w.cfg.MaxBuffer {
+		atomic.AddUint64(&w.dropped, uint64(len(p)))
+		return len(p), nil
+	}
+	atomic.AddUint64(&w.queued, uint64(len(p)))
+	w.cur = append(w.cur, p...)
+	if len(w.cur) >= w.cfg.BatchSize {
+		w.cut()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// cut moves the current batch to the pending ones, the caller holds mu
+func (w *Writer) cut() {
+	if len(w.cur) == 0 {
+		return
+	}
+	w.pending = append(w.pending, w.cur)
+	w.pendingBytes += len(w.cur)
+	w.cur = make([]byte, 0, w.cfg.BatchSize)
+}
+
+func (w *Writer) takePending() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cut()
+	batches := w.pending
+	w.pending = nil
+	w.pendingBytes = 0
+	return batches
+}
+
+// Stats returns the counters of the Writer
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Queued:  atomic.LoadUint64(&w.queued),
+		Sent:    atomic.LoadUint64(&w.sent),
+		Dropped: atomic.LoadUint64(&w.dropped),
+	}
+}
+
+// Flush sends the lines written so far, with the spooled ones before.
+// It returns the error of the connection when some of them were not sent
+func (w *Writer) Flush() error {
+	reply := make(chan error, 1)
+	select {
+	case w.flushes <- reply:
+		return <-reply
+	case <-w.stopped:
+		return ErrClosed
+	}
+}
+
+// Close sends, or spools, the lines written so far and closes the connection
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.done)
+	<-w.stopped
+	return nil
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.wake:
+		case <-ticker.C:
+		case reply := <-w.flushes:
+			reply <- w.ship()
+			continue
+		case <-w.done:
+			w.ship()
+			w.dropRetries(0, ErrClosed)
+			if w.conn != nil {
+				w.conn.Close()
+			}
+			return
+		}
+		w.ship()
+	}
+}
+
+// ship sends the spooled batches, the ones kept for retry and then the
+// pending ones. The batches not sent are spooled or kept for retry
+func (w *Writer) ship() error {
+	batches := w.takePending()
+	w.dropRetries(w.cfg.RetryTimeout, nil)
+	err := w.connect()
+	if err == nil {
+		err = w.drainSpool()
+	}
+	if err == nil {
+		err = w.sendRetries()
+	}
+	for _, b := range batches {
+		if err == nil {
+			err = w.send(b)
+		}
+		if err != nil {
+			w.keep(b)
+		}
+	}
+	return err
+}
+
+// keep spools b or, without SpoolDir, keeps it in memory for retry
+func (w *Writer) keep(b []byte) {
+	if w.cfg.SpoolDir != "" {
+		w.spool(b)
+		return
+	}
+	w.retry = append(w.retry, retryBatch{b: b, since: time.Now()})
+	w.mu.Lock()
+	w.retryBytes += len(b)
+	w.mu.Unlock()
+}
+
+// sendRetries sends the batches kept for retry, in order
+func (w *Writer) sendRetries() error {
+	for len(w.retry) > 0 {
+		b := w.retry[0].b
+		if err := w.send(b); err != nil {
+			return err
+		}
+		w.retry = w.retry[1:]
+		w.mu.Lock()
+		w.retryBytes -= len(b)
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// dropRetries drops the batches kept for retry longer than timeout, all
+// of them when it's 0
+func (w *Writer) dropRetries(timeout time.Duration, reason error) {
+	n, size := 0, 0
+	for _, r := range w.retry {
+		if timeout > 0 && time.Since(r.since) < timeout {
+			break
+		}
+		w.drop(len(r.b))
+		n++
+		size += len(r.b)
+	}
+	if n == 0 {
+		return
+	}
+	w.retry = w.retry[n:]
+	w.mu.Lock()
+	w.retryBytes -= size
+	w.mu.Unlock()
+	if reason == nil {
+		reason = fmt.Errorf("not sent in %s", timeout)
+	}
+	w.report(fmt.Errorf("tcp: dropped %d batches: %w", n, reason))
+}
+
+func (w *Writer) report(err error) {
+	if w.cfg.ErrorHandler != nil {
+		w.cfg.ErrorHandler(err)
+	}
+}
+
+// connect dials the server when it's not connected and the backoff time passed
+func (w *Writer) connect() error {
+	if w.conn != nil {
+		return nil
+	}
+	if time.Now().Before(w.nextDial) {
+		return ErrNotConnected
+	}
+	dialer := &net.Dialer{Timeout: w.cfg.DialTimeout}
+	var conn net.Conn
+	var err error
+	if w.cfg.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.cfg.Addr, w.cfg.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", w.cfg.Addr)
+	}
+	if err != nil {
+		w.fail()
+		return err
+	}
+	w.conn = conn
+	w.backoff = 0
+	w.nextDial = time.Time{}
+	return nil
+}
+
+// fail drops the connection and waits longer before the next reconnect
+func (w *Writer) fail() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	if w.backoff == 0 {
+		w.backoff = w.cfg.MinBackoff
+	} else if w.backoff *= 2; w.backoff > w.cfg.MaxBackoff {
+		w.backoff = w.cfg.MaxBackoff
+	}
+	w.nextDial = time.Now().Add(w.backoff)
+}
+
+func (w *Writer) send(b []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(w.cfg.WriteTimeout))
+	if _, err := w.conn.Write(b); err != nil {
+		w.fail()
+		return err
+	}
+	atomic.AddUint64(&w.sent, uint64(len(b)))
+	atomic.AddUint64(&w.queued, ^uint64(len(b)-1))
+	return nil
+}
+
+// drop counts n queued bytes as dropped
+func (w *Writer) drop(n int) {
+	atomic.AddUint64(&w.dropped, uint64(n))
+	atomic.AddUint64(&w.queued, ^uint64(n-1))
+}
+
+// openSpool loads the size and the last sequence of the spooled batches
+func (w *Writer) openSpool() error {
+	if err := os.MkdirAll(w.cfg.SpoolDir, 0755); err != nil {
+		return err
+	}
+	names, err := w.spooled()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		w.spoolSize += info.Size()
+		atomic.AddUint64(&w.queued, uint64(info.Size()))
+		seq, _ := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), spoolExt), 10, 64)
+		if seq > w.seq {
+			w.seq = seq
+		}
+	}
+	return nil
+}
+
+// spooled returns the spooled batches from the oldest to the newest
+func (w *Writer) spooled() ([]string, error) {
+	entries, err := os.ReadDir(w.cfg.SpoolDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolExt) {
+			names = append(names, filepath.Join(w.cfg.SpoolDir, e.Name()))
+		}
+	}
+	// the names have the same size, see spool
+	sort.Strings(names)
+	return names, nil
+}
+
+// spool writes b to the spool, it's dropped when the spool is disabled or full
+func (w *Writer) spool(b []byte) {
+	if w.cfg.SpoolDir == "" || w.spoolSize+int64(len(b)) > w.cfg.MaxSpoolSize {
+		w.drop(len(b))
+		return
+	}
+	w.seq++
+	name := filepath.Join(w.cfg.SpoolDir, fmt.Sprintf("%020d%s", w.seq, spoolExt))
+	if err := os.WriteFile(name, b, 0600); err != nil {
+		os.Remove(name)
+		w.drop(len(b))
+		w.report(fmt.Errorf("tcp: dropped a batch: %w", err))
+		return
+	}
+	w.spoolSize += int64(len(b))
+}
+
+// drainSpool sends the spooled batches in order, removing the ones sent
+func (w *Writer) drainSpool() error {
+	if w.cfg.SpoolDir == "" || w.spoolSize == 0 {
+		return nil
+	}
+	names, err := w.spooled()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			w.quarantine(name, err)
+			continue
+		}
+		if err := w.send(b); err != nil {
+			return err
+		}
+		os.Remove(name)
+		w.spoolSize -= int64(len(b))
+	}
+	return nil
+}
+
+// quarantine renames the spooled batch name, that can't be read, so it's
+// not retried, or removes it when the rename fails
+func (w *Writer) quarantine(name string, err error) {
+	if info, serr := os.Stat(name); serr == nil {
+		w.spoolSize -= info.Size()
+		w.drop(int(info.Size()))
+	}
+	if rerr := os.Rename(name, strings.TrimSuffix(name, spoolExt)+".corrupt"); rerr != nil {
+		os.Remove(name)
+	}
+	w.report(fmt.Errorf("tcp: spooled batch %s set aside: %w", filepath.Base(name), err))
+}
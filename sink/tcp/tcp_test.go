@@ -0,0 +1,299 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/axpira/goplogjson"
+)
+
+// server is a local stand-in for the log collector
+type server struct {
+	ln    net.Listener
+	lines chan string
+}
+
+func newServer(t *testing.T, ln net.Listener) *server {
+	t.Helper()
+	s := &server{ln: ln, lines: make(chan string, 100)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewScanner(c)
+				for r.Scan() {
+					s.lines <- r.Text()
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func listen(t *testing.T, addr string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln
+}
+
+func (s *server) expect(t *testing.T, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-s.lines:
+			if got != w {
+				t.Errorf("want %q and got %q", w, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting %q", w)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	s := newServer(t, listen(t, "127.0.0.1:0"))
+	w, err := New(Config{Addr: s.ln.Addr().String(), BatchSize: 16, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := goplogjson.DefaultEncoderConfig()
+	cfg.TimestampDisabled = true
+	l := goplogjson.New(goplogjson.WithOutput(w), goplogjson.WithEncoderConfig(cfg))
+	l.Info("first")
+	s.expect(t, `{"msg":"first","level":"info"}`)
+
+	w.Write([]byte("small\n"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(t, "small")
+	if err := l.(goplogjson.Syncer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if st := w.Stats(); st.Queued != 0 || st.Sent != 37 || st.Dropped != 0 {
+		t.Errorf("wrong stats %+v", st)
+	}
+	if _, err := w.Write([]byte("closed\n")); err != ErrClosed {
+		t.Errorf("want %v and got %v", ErrClosed, err)
+	}
+}
+
+func TestWriterSpoolReplay(t *testing.T) {
+	ln := listen(t, "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Addr: addr, SpoolDir: dir, FlushInterval: time.Hour, MinBackoff: time.Millisecond}
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.Write([]byte("line " + strconv.Itoa(i) + "\n"))
+		if err := w.Flush(); err == nil {
+			t.Fatal("want error with the server down")
+		}
+	}
+	if st := w.Stats(); st.Queued != 21 || st.Sent != 0 {
+		t.Errorf("wrong stats %+v", st)
+	}
+	w.Close()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Fatalf("want 3 spooled batches and got %d", len(entries))
+	}
+
+	// a new writer replays the spool of the previous one
+	s := newServer(t, listen(t, addr))
+	w, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if st := w.Stats(); st.Queued != 21 {
+		t.Errorf("want spool loaded and got %+v", st)
+	}
+	w.Write([]byte("line 3\n"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(t, "line 0", "line 1", "line 2", "line 3")
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("want spool empty and got %d batches", len(entries))
+	}
+	if st := w.Stats(); st.Queued != 0 || st.Sent != 28 {
+		t.Errorf("wrong stats %+v", st)
+	}
+}
+
+func TestWriterDrop(t *testing.T) {
+	ln := listen(t, "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w, err := New(Config{Addr: addr, SpoolDir: t.TempDir(), MaxSpoolSize: 10,
+		BatchSize: 100, MaxBuffer: 20, FlushInterval: time.Hour, MinBackoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("spooled\n"))
+	w.Write([]byte("buffer full, dropped\n"))
+	w.Flush()
+	w.Write([]byte("spool full\n"))
+	w.Flush()
+	if st := w.Stats(); st.Queued != 8 || st.Dropped != 32 {
+		t.Errorf("wrong stats %+v", st)
+	}
+}
+
+func TestWriterRetryInMemory(t *testing.T) {
+	ln := listen(t, "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w, err := New(Config{Addr: addr, FlushInterval: time.Hour, MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("line 0\n"))
+	if err := w.Flush(); err == nil {
+		t.Fatal("want error with the server down")
+	}
+	s := newServer(t, listen(t, addr))
+	w.Write([]byte("line 1\n"))
+	time.Sleep(5 * time.Millisecond)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(t, "line 0", "line 1")
+	if st := w.Stats(); st.Queued != 0 || st.Dropped != 0 || st.Sent != 14 {
+		t.Errorf("wrong stats %+v", st)
+	}
+}
+
+func TestWriterRetryTimeout(t *testing.T) {
+	ln := listen(t, "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var errs []error
+	w, err := New(Config{Addr: addr, FlushInterval: time.Hour, MinBackoff: time.Hour,
+		RetryTimeout: time.Millisecond, ErrorHandler: func(err error) { errs = append(errs, err) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("dropped\n"))
+	w.Flush()
+	time.Sleep(5 * time.Millisecond)
+	w.Flush()
+	if st := w.Stats(); st.Queued != 0 || st.Dropped != 8 {
+		t.Errorf("wrong stats %+v", st)
+	}
+	if len(errs) != 1 {
+		t.Errorf("want 1 error reported and got %v", errs)
+	}
+}
+
+func TestWriterSpoolCorrupt(t *testing.T) {
+	s := newServer(t, listen(t, "127.0.0.1:0"))
+	dir := t.TempDir()
+	// a dangling link with the name of a batch can't be read
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "00000000000000000001.spool")); err != nil {
+		t.Skip("symlink not supported:", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000002.spool"), []byte("line 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	w, err := New(Config{Addr: s.ln.Addr().String(), SpoolDir: dir, FlushInterval: time.Hour,
+		ErrorHandler: func(err error) { errs = append(errs, err) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(t, "line 0")
+	w.Flush()
+	if len(errs) != 1 {
+		t.Errorf("want 1 error reported and got %v", errs)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "00000000000000000001.corrupt")); err != nil {
+		t.Errorf("want batch set aside: %v", err)
+	}
+}
+
+func TestWriterTLS(t *testing.T) {
+	cert, pool := testCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(t, ln)
+	w, err := New(Config{Addr: ln.Addr().String(), TLSConfig: &tls.Config{RootCAs: pool, ServerName: "localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("secure\n"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(t, "secure")
+}
+
+// testCert returns a self signed certificate for localhost
+func testCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
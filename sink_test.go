@@ -0,0 +1,134 @@
+package goplogjson
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axpira/gop/log"
+)
+
+type slowFlusher struct {
+	strings.Builder
+	delay time.Duration
+}
+
+func (w *slowFlusher) Flush() error {
+	time.Sleep(w.delay)
+	return nil
+}
+
+func TestLoggerSyncAndClose(t *testing.T) {
+	out := new(strings.Builder)
+	buf := bufio.NewWriter(out)
+	l := New(WithOutput(buf))
+	l.Info("test")
+	if out.Len() != 0 {
+		t.Fatalf("want buffered line and got %q", out.String())
+	}
+	if err := l.(Syncer).Sync(); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+	RegisterSink(buf)
+	if err := l.(Syncer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	sinks.Lock()
+	_, ok := sinks.m[buf]
+	sinks.Unlock()
+	if ok {
+		t.Errorf("want sink unregistered after Close")
+	}
+}
+
+func TestPanicFlushSinks(t *testing.T) {
+	oldHook := levelHook
+	defer func() { levelHook = oldHook }()
+	levelHook = map[log.Level]func(io.Writer){log.PanicLevel: panicHook}
+
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithAsync(AsyncConfig{}))
+	defer l.(Syncer).Close()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("want panic")
+			}
+		}()
+		l.Panic("test")
+	}()
+	want := `{"level":"panic", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestPanicFlushRegisteredSinks(t *testing.T) {
+	oldHook := levelHook
+	defer func() { levelHook = oldHook }()
+	levelHook = map[log.Level]func(io.Writer){log.PanicLevel: panicHook}
+
+	// the panic line goes to the logger output, the other line to a
+	// buffered writer registered as a sink
+	other := new(strings.Builder)
+	buf := bufio.NewWriter(other)
+	RegisterSink(buf)
+	defer UnregisterSink(buf)
+	New(WithOutput(buf)).Info("buffered")
+
+	l := New(WithOutput(new(strings.Builder)))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("want panic")
+			}
+		}()
+		l.Panic("test")
+	}()
+	want := `{"level":"info", "msg":"buffered", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, other.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestSyncSinksSingleTimeout(t *testing.T) {
+	w := &slowFlusher{delay: time.Second}
+	out := &slowFlusher{delay: time.Second}
+	RegisterSink(w)
+	defer UnregisterSink(w)
+	start := time.Now()
+	if err := syncSinks(50*time.Millisecond, out); err != ErrFlushTimeout {
+		t.Errorf("want %v and got %v", ErrFlushTimeout, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("want one timeout and waited %s", d)
+	}
+}
+
+func TestLoggerOutputNotRegistered(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		buf := bufio.NewWriter(new(strings.Builder))
+		New(WithOutput(buf), WithAsync(AsyncConfig{})).(Syncer).Close()
+		New(WithOutput(buf), WithOutput(new(strings.Builder)))
+	}
+	sinks.Lock()
+	defer sinks.Unlock()
+	if len(sinks.m) != 0 {
+		t.Errorf("want no sink registered and got %d", len(sinks.m))
+	}
+}
+
+func TestSyncSinksTimeout(t *testing.T) {
+	w := &slowFlusher{delay: time.Second}
+	RegisterSink(w)
+	defer UnregisterSink(w)
+	if err := SyncSinks(10 * time.Millisecond); err != ErrFlushTimeout {
+		t.Errorf("want %v and got %v", ErrFlushTimeout, err)
+	}
+}
@@ -0,0 +1,175 @@
+//go:build go1.21
+// +build go1.21
+
+package goplogjson
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/axpira/gop/log"
+)
+
+type slogGroup struct {
+	name string
+	// buf has the attributes added by WithAttrs after the group was opened
+	buf []byte
+}
+
+type slogHandler struct {
+	l      *logger
+	groups []slogGroup
+}
+
+// NewSlogHandler returns a slog.Handler writing with l, so slog records
+// share the output and the encoder of the logger. When l was not created
+// by New a new logger is used
+func NewSlogHandler(l log.Logger) slog.Handler {
+	l1, ok := l.(*logger)
+	if !ok {
+		l1 = newLogger()
+	}
+	return &slogHandler{l: l1}
+}
+
+// slogLevel maps a slog level to a log level, levels above
+// slog.LevelError are logged as error so slog never exits or panics
+func slogLevel(lv slog.Level) log.Level {
+	switch {
+	case lv < slog.LevelDebug:
+		return log.TraceLevel
+	case lv < slog.LevelInfo:
+		return log.DebugLevel
+	case lv < slog.LevelWarn:
+		return log.InfoLevel
+	case lv < slog.LevelError:
+		return log.WarnLevel
+	}
+	return log.ErrorLevel
+}
+
+func (h *slogHandler) Enabled(_ context.Context, lv slog.Level) bool {
+	return h.l.HasLevel(slogLevel(lv))
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	lv := slogLevel(r.Level)
+	if !h.l.HasLevel(lv) {
+		return nil
+	}
+	f := h.l.NewFieldBuilder().(*field)
+	f.Msg(r.Message)
+	if r.Time.IsZero() {
+		f.noTs = true
+	} else {
+		f.ts = r.Time
+	}
+	if len(h.groups) == 0 {
+		r.Attrs(f.appendAttr)
+		h.l.Log(lv, f)
+		return nil
+	}
+	// the attributes of the record belong to the innermost group,
+	// each group is then added as a Dict of its parent
+	last := len(h.groups) - 1
+	cur := h.newField()
+	cur.buf = append(cur.buf, h.groups[last].buf...)
+	r.Attrs(cur.appendAttr)
+	for i := last; i > 0; i-- {
+		parent := h.newField()
+		parent.buf = append(parent.buf, h.groups[i-1].buf...)
+		parent.appendGroup(h.groups[i].name, cur)
+		cur = parent
+	}
+	f.appendGroup(h.groups[0].name, cur)
+	h.l.Log(lv, f)
+	return nil
+}
+
+// WithAttrs encodes attrs once, in the logger buf like Update when no group
+// is open, otherwise in the buf of the innermost group
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	f := h.newField()
+	for _, a := range attrs {
+		f.appendAttr(a)
+	}
+	h1 := &slogHandler{l: h.l, groups: h.groups}
+	if len(h.groups) == 0 {
+		h1.l = f.Update(h.l).(*logger)
+		return h1
+	}
+	h1.groups = append([]slogGroup(nil), h.groups...)
+	g := &h1.groups[len(h1.groups)-1]
+	g.buf = append(append([]byte(nil), g.buf...), f.buf...)
+	f.discard()
+	return h1
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := make([]slogGroup, len(h.groups), len(h.groups)+1)
+	copy(groups, h.groups)
+	return &slogHandler{l: h.l, groups: append(groups, slogGroup{name: name})}
+}
+
+func (h *slogHandler) newField() *field {
+	f := newField()
+	f.cfg = h.l.cfg
+	return f
+}
+
+// appendGroup adds g as a Dict, empty groups are omitted
+func (f *field) appendGroup(key string, g *field) {
+	if len(g.buf) == 0 {
+		g.discard()
+		return
+	}
+	f.Dict(key, g)
+}
+
+// appendAttr adds a slog.Attr to f, it has the signature expected by
+// slog.Record.Attrs
+func (f *field) appendAttr(a slog.Attr) bool {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return true
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		f.Str(a.Key, a.Value.String())
+	case slog.KindInt64:
+		f.Int64(a.Key, a.Value.Int64())
+	case slog.KindUint64:
+		f.Uint64(a.Key, a.Value.Uint64())
+	case slog.KindFloat64:
+		f.Float64(a.Key, a.Value.Float64())
+	case slog.KindBool:
+		f.Bool(a.Key, a.Value.Bool())
+	case slog.KindDuration:
+		f.Dur(a.Key, a.Value.Duration())
+	case slog.KindTime:
+		f.Time(a.Key, a.Value.Time())
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		if a.Key == "" {
+			for _, ga := range attrs {
+				f.appendAttr(ga)
+			}
+			return true
+		}
+		g := newField()
+		g.cfg = f.cfg
+		for _, ga := range attrs {
+			g.appendAttr(ga)
+		}
+		f.appendGroup(a.Key, g)
+	default:
+		f.Interface(a.Key, a.Value.Any())
+	}
+	return true
+}
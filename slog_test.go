@@ -0,0 +1,50 @@
+//go:build go1.21
+// +build go1.21
+
+package goplogjson
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	out := new(bytes.Buffer)
+	cfg := DefaultEncoderConfig()
+	cfg.DurationFieldUnit = time.Second
+	h := NewSlogHandler(New(WithOutput(out), WithEncoderConfig(cfg)))
+
+	results := func() []map[string]interface{} {
+		var ms []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			m, err := stringToMap(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms = append(ms, m)
+		}
+		return ms
+	}
+	if err := slogtest.TestHandler(h, results); err != nil {
+		t.Error(err)
+	}
+
+	out.Reset()
+	slog.New(h).With("req", 1).WithGroup("g").With("a", "b").
+		Warn("test", "dur", time.Minute, slog.Group("sub", "c", true))
+	want := `{"level":"warn", "msg":"test", "req":1, "g":{"a":"b", "dur":60, "sub":{"c":true}}, "time":"2021-09-26T07:57:36Z"}`
+	// slog sets the time of the record
+	got, err := stringToMap(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got["time"] = "2021-09-26T07:57:36Z"
+	wantMap, _ := stringToMap(want)
+	if diff := compareMaps(wantMap, got); diff != "" {
+		t.Errorf(diff)
+	}
+}
@@ -0,0 +1,78 @@
+package goplogjson
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+
+	"github.com/axpira/gop/log"
+)
+
+// WithStack adds the stack field, with the frames of the goroutine,
+// to the lines with level lv or above. Errors added with Err that carry
+// a stack have it logged instead, see stackTracer
+func WithStack(lv log.Level) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.stackLevel = lv
+		return l1
+	})
+}
+
+// stackTracer is implemented by the errors that carry the program
+// counters of the stack where they were created. The errors of
+// github.com/pkg/errors return their own StackTrace type, they need a
+// wrapper converting it to []uintptr
+type stackTracer interface {
+	StackTrace() []uintptr
+}
+
+// errorStack returns the innermost error of the chain of err that
+// carries a stack, or nil. The stack is read only when the line is logged
+// with a level that has it
+func errorStack(err error) stackTracer {
+	var st stackTracer
+	for ; err != nil; err = errors.Unwrap(err) {
+		if s, ok := err.(stackTracer); ok {
+			st = s
+		}
+	}
+	return st
+}
+
+// callersStack returns the program counters of the goroutine
+func callersStack() []uintptr {
+	pcs := make([]uintptr, 64)
+	// skip runtime.Callers and callersStack
+	return pcs[:runtime.Callers(2, pcs)]
+}
+
+// appendStack adds the stack field as an array of frames with function,
+// file and line, the frames of the logger are skipped
+func (f *field) appendStack(pcs []uintptr) {
+	f.buf = appendKey(f.buf, f.cfg.stackFieldName())
+	f.buf = append(f.buf, '[')
+	first := true
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !isLoggerFunc(frame.Function) {
+			if !first {
+				f.buf = append(f.buf, ',')
+			}
+			first = false
+			f.buf = append(f.buf, `{"func":`...)
+			f.buf = appendString(f.buf, frame.Function)
+			f.buf = append(f.buf, `,"file":`...)
+			f.buf = appendString(f.buf, frame.File)
+			f.buf = append(f.buf, `,"line":`...)
+			f.buf = strconv.AppendInt(f.buf, int64(frame.Line), 10)
+			f.buf = append(f.buf, '}')
+		}
+		if !more {
+			break
+		}
+	}
+	f.buf = append(f.buf, ']')
+	f.hasStack = true
+}
@@ -0,0 +1,89 @@
+package goplogjson
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/axpira/gop/log"
+)
+
+// stackError is an error carrying the stack where it was created
+type stackError struct {
+	msg    string
+	pcs    []uintptr
+	traced int
+}
+
+func (e *stackError) Error() string {
+	return e.msg
+}
+
+func (e *stackError) StackTrace() []uintptr {
+	e.traced++
+	return e.pcs
+}
+
+func newStackError(msg string) error {
+	pcs := make([]uintptr, 32)
+	return &stackError{msg: msg, pcs: pcs[:runtime.Callers(1, pcs)]}
+}
+
+func stackFrames(t *testing.T, line string) []interface{} {
+	m, err := stringToMap(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, ok := m["stack"].([]interface{})
+	if !ok || len(frames) == 0 {
+		t.Fatalf("want stack field and got %s", line)
+	}
+	return frames
+}
+
+func TestLoggerStack(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithStack(log.ErrorLevel))
+
+	l.Warn("no stack")
+	if strings.Contains(out.String(), `"stack"`) {
+		t.Errorf("want no stack below error level and got %s", out.String())
+	}
+
+	out.Reset()
+	l.Error("test", errors.New("failed"))
+	top := stackFrames(t, out.String())[0].(map[string]interface{})
+	if top["func"] != "github.com/axpira/goplogjson.TestLoggerStack" {
+		t.Errorf("want stack starting on the test and got %v", top)
+	}
+	if _, ok := top["line"].(float64); !ok || !strings.HasSuffix(top["file"].(string), "stack_test.go") {
+		t.Errorf("want file and line of the test and got %v", top)
+	}
+
+	out.Reset()
+	l.Error("test", fmt.Errorf("wrapped: %w", newStackError("failed")))
+	top = stackFrames(t, out.String())[0].(map[string]interface{})
+	if top["func"] != "github.com/axpira/goplogjson.newStackError" {
+		t.Errorf("want stack of the error and got %v", top)
+	}
+	if n := strings.Count(out.String(), `"stack"`); n != 1 {
+		t.Errorf("want one stack field and got %d", n)
+	}
+}
+
+func TestLoggerStackOnlyAtLevel(t *testing.T) {
+	out := new(strings.Builder)
+	l := New(WithOutput(out), WithStack(log.ErrorLevel))
+	err := newStackError("failed").(*stackError)
+	l.Warn(err.Error())
+	l.Wrn(l.NewFieldBuilder().Err(err))
+	if err.traced != 0 || strings.Contains(out.String(), `"stack"`) {
+		t.Errorf("want no stack below error level and got %d calls: %s", err.traced, out.String())
+	}
+	l.Err(l.NewFieldBuilder().Err(err))
+	if err.traced != 1 {
+		t.Errorf("want the stack read once and got %d", err.traced)
+	}
+}
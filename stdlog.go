@@ -0,0 +1,75 @@
+package goplogjson
+
+import (
+	"bytes"
+	stdlog "log"
+	"time"
+
+	"github.com/axpira/gop/log"
+)
+
+// WithStdFlags sets the flags of the standard log package writing to the
+// logger, so Write can parse the header of each line: the date and time
+// become the timestamp and the file and line become the caller field
+func WithStdFlags(flags int) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		l1.stdFlags = flags
+		return l1
+	})
+}
+
+// NewStdLogger returns a standard log.Logger writing to l with level lv.
+// When l is not a logger of this package the lines are logged with
+// l.Write and flags are not parsed
+func NewStdLogger(l log.Logger, lv log.Level, flags int) *stdlog.Logger {
+	if l1, ok := l.(*logger); ok {
+		l2 := l1.clone()
+		l2.stdLevel = lv
+		l2.stdFlags = flags
+		l = l2
+	}
+	return stdlog.New(l, "", flags)
+}
+
+// parseStdHeader removes from msg the header written by the standard log
+// package with flags, adding the time and the caller found in it to f
+func (f *field) parseStdHeader(msg []byte, flags int) []byte {
+	if flags&(stdlog.Ldate|stdlog.Ltime|stdlog.Lmicroseconds) != 0 {
+		loc := time.Local
+		if flags&stdlog.LUTC != 0 {
+			loc = time.UTC
+		}
+		layout := ""
+		if flags&stdlog.Ldate != 0 {
+			layout = "2006/01/02 "
+		}
+		if flags&(stdlog.Ltime|stdlog.Lmicroseconds) != 0 {
+			layout += "15:04:05"
+			if flags&stdlog.Lmicroseconds != 0 {
+				layout += ".000000"
+			}
+			layout += " "
+		}
+		if len(msg) < len(layout) {
+			return msg
+		}
+		t, err := time.ParseInLocation(layout, string(msg[:len(layout)]), loc)
+		if err != nil {
+			return msg
+		}
+		if flags&stdlog.Ldate == 0 {
+			y, m, d := f.cfg.timestamp().In(loc).Date()
+			t = time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+		}
+		f.ts = t
+		msg = msg[len(layout):]
+	}
+	if flags&(stdlog.Lshortfile|stdlog.Llongfile) != 0 {
+		if i := bytes.Index(msg, []byte(": ")); i > 0 {
+			f.Bytes(f.cfg.callerFieldName(), msg[:i])
+			msg = msg[i+2:]
+		}
+	}
+	return msg
+}
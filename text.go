@@ -0,0 +1,119 @@
+package goplogjson
+
+import (
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// textMode defines the rules of the key=value formats
+type textMode uint8
+
+const (
+	// textConsole keeps keys and values readable, values are quoted only
+	// when they are empty or have spaces, quotes or escapes
+	textConsole textMode = iota
+	// textLogfmt follows logfmt, keys have only valid characters and
+	// every value that is not a single token is quoted
+	textLogfmt
+)
+
+// appendTextFields appends the fields of the JSON object obj as key=value
+// pairs, nested objects are flattened with dotted keys after prefix, an
+// empty one is written as key={}.
+// At the top level the timestamp, level and message fields are skipped,
+// they are written before by the format
+func appendTextFields(dst, obj, prefix []byte, cfg *EncoderConfig, mode textMode, color bool) []byte {
+	for key, value, rest, ok := nextField(obj); ok; key, value, rest, ok = nextField(rest) {
+		if len(prefix) == 0 && (keyIs(key, cfg.timestampFieldName()) ||
+			keyIs(key, cfg.messageFieldName()) ||
+			keyIs(key, cfg.levelFieldName())) {
+			continue
+		}
+		name := appendTextKey(prefix, key, mode)
+		if value[0] == '{' && len(value) > 2 {
+			dst = appendTextFields(dst, value, append(name, '.'), cfg, mode, color)
+			continue
+		}
+		dst = append(dst, ' ')
+		isErr := len(prefix) == 0 && keyIs(key, cfg.errorFieldName())
+		dst = appendTextPair(dst, name, value, mode, color, isErr)
+	}
+	return dst
+}
+
+func appendTextPair(dst, name, value []byte, mode textMode, color, isErr bool) []byte {
+	if color {
+		dst = append(dst, colorCyan...)
+		dst = append(dst, name...)
+		dst = append(dst, '=')
+		dst = append(dst, colorReset...)
+	} else {
+		dst = append(dst, name...)
+		dst = append(dst, '=')
+	}
+	if isErr && color {
+		dst = append(dst, colorRed...)
+		dst = appendTextValue(dst, value, mode)
+		return append(dst, colorReset...)
+	}
+	return appendTextValue(dst, value, mode)
+}
+
+// appendTextKey appends the raw JSON key decoded, logfmt keys have
+// spaces, '=', quotes and backslashes replaced by '_'
+func appendTextKey(dst, key []byte, mode textMode) []byte {
+	if mode != textLogfmt {
+		return appendUnquoted(dst, key)
+	}
+	var arr [64]byte
+	for _, b := range appendUnquoted(arr[:0], key) {
+		if b <= ' ' || b == '=' || b == '"' || b == '\\' || b == 0x7f {
+			b = '_'
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// appendTextValue appends a raw JSON value. Strings are decoded and
+// written without quotes when they are a single token, otherwise they
+// are quoted again with the Go escapes, as logfmt parsers expect.
+// In logfmt arrays are quoted too
+func appendTextValue(dst, value []byte, mode textMode) []byte {
+	switch value[0] {
+	case '"':
+		var arr [128]byte
+		s := appendUnquoted(arr[:0], value)
+		if len(s) == 0 || needsQuote(s) {
+			return strconv.AppendQuote(dst, string(s))
+		}
+		return append(dst, s...)
+	case '[':
+		if mode == textLogfmt && needsQuote(value) {
+			return strconv.AppendQuote(dst, string(value))
+		}
+	}
+	return append(dst, value...)
+}
+
+// needsQuote reports if s has spaces, '=', quotes, backslashes or
+// characters that are not printable
+func needsQuote(s []byte) bool {
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b <= ' ' || b == '=' || b == '"' || b == '\\' || b == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+		i += n
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package goplogjson
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"github.com/axpira/gop/log"
+)
+
+// ErrInvalidTraceparent is returned by ParseTraceparent when the header
+// is not a valid W3C traceparent
+var ErrInvalidTraceparent = errors.New("goplogjson: invalid traceparent")
+
+// SpanContext is the W3C trace context of a span
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// IsValid reports if both the trace and the span ids are not zero
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// IsSampled reports if the sampled flag is set
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&1 == 1
+}
+
+// Traceparent returns sc as a W3C traceparent header
+func (sc SpanContext) Traceparent() string {
+	buf := make([]byte, 0, 55)
+	buf = append(buf, "00-"...)
+	buf = appendHex(buf, sc.TraceID[:])
+	buf = append(buf, '-')
+	buf = appendHex(buf, sc.SpanID[:])
+	buf = append(buf, '-')
+	buf = appendHex(buf, []byte{sc.Flags})
+	return string(buf)
+}
+
+// ParseTraceparent parses a W3C traceparent header
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' || s[:2] == "ff" ||
+		(len(s) > 55 && (s[:2] == "00" || s[55] != '-')) {
+		return sc, ErrInvalidTraceparent
+	}
+	var version, flags [1]byte
+	if !decodeHex(version[:], s[:2]) || !decodeHex(sc.TraceID[:], s[3:35]) ||
+		!decodeHex(sc.SpanID[:], s[36:52]) || !decodeHex(flags[:], s[53:55]) {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx with sc, it's read by the
+// default SpanContextFromContext
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context used by Ctx, by default
+// the one stored by ContextWithSpanContext. Replace it to read the span
+// of a tracing library, like OpenTelemetry
+var SpanContextFromContext = func(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// TraceFormat defines the trace fields added by Ctx
+type TraceFormat struct {
+	// TraceIDFieldName defines the key name for the trace id
+	TraceIDFieldName string
+	// SpanIDFieldName defines the key name for the span id
+	SpanIDFieldName string
+	// TraceFlagsFieldName defines the key name for the trace flags,
+	// when it's empty the flags are not logged
+	TraceFlagsFieldName string
+	// SampledAsBool logs the sampled flag as a bool instead of the
+	// flags in hex
+	SampledAsBool bool
+	// TraceIDFunc and SpanIDFunc format the ids, by default in hex
+	TraceIDFunc func(SpanContext) string
+	SpanIDFunc  func(SpanContext) string
+}
+
+// W3CTraceFormat logs trace_id, span_id and trace_flags in hex
+func W3CTraceFormat() TraceFormat {
+	return TraceFormat{
+		TraceIDFieldName:    "trace_id",
+		SpanIDFieldName:     "span_id",
+		TraceFlagsFieldName: "trace_flags",
+	}
+}
+
+// DatadogTraceFormat logs dd.trace_id and dd.span_id in decimal, the
+// trace id is its lower 64 bits
+func DatadogTraceFormat() TraceFormat {
+	return TraceFormat{
+		TraceIDFieldName: "dd.trace_id",
+		SpanIDFieldName:  "dd.span_id",
+		TraceIDFunc: func(sc SpanContext) string {
+			return strconv.FormatUint(binary.BigEndian.Uint64(sc.TraceID[8:]), 10)
+		},
+		SpanIDFunc: func(sc SpanContext) string {
+			return strconv.FormatUint(binary.BigEndian.Uint64(sc.SpanID[:]), 10)
+		},
+	}
+}
+
+// GCPTraceFormat logs the trace fields of Google Cloud Logging, the
+// trace is the resource name of the trace in projectID
+func GCPTraceFormat(projectID string) TraceFormat {
+	return TraceFormat{
+		TraceIDFieldName:    "logging.googleapis.com/trace",
+		SpanIDFieldName:     "logging.googleapis.com/spanId",
+		TraceFlagsFieldName: "logging.googleapis.com/trace_sampled",
+		SampledAsBool:       true,
+		TraceIDFunc: func(sc SpanContext) string {
+			return "projects/" + projectID + "/traces/" + string(appendHex(nil, sc.TraceID[:]))
+		},
+	}
+}
+
+// WithTraceFormat sets the trace fields added by Ctx, see
+// EncoderConfig.TraceFormat
+func WithTraceFormat(tf TraceFormat) log.LoggerOption {
+	return log.LoggerOptionFunc(func(l log.Logger) log.Logger {
+		l1 := l.(*logger)
+		cfg := l1.config()
+		cfg.TraceFormat = tf
+		l1.cfg = &cfg
+		return l1
+	})
+}
+
+// appendTrace adds the trace fields of sc
+func (f *field) appendTrace(sc SpanContext) {
+	tf := f.cfg.traceFormat()
+	if tf.TraceIDFunc != nil {
+		f.Str(tf.TraceIDFieldName, tf.TraceIDFunc(sc))
+	} else {
+		f.buf = append(appendKey(f.buf, tf.TraceIDFieldName), '"')
+		f.buf = append(appendHex(f.buf, sc.TraceID[:]), '"')
+	}
+	if tf.SpanIDFunc != nil {
+		f.Str(tf.SpanIDFieldName, tf.SpanIDFunc(sc))
+	} else {
+		f.buf = append(appendKey(f.buf, tf.SpanIDFieldName), '"')
+		f.buf = append(appendHex(f.buf, sc.SpanID[:]), '"')
+	}
+	switch {
+	case tf.TraceFlagsFieldName == "":
+	case tf.SampledAsBool:
+		f.Bool(tf.TraceFlagsFieldName, sc.IsSampled())
+	default:
+		f.buf = append(appendKey(f.buf, tf.TraceFlagsFieldName), '"')
+		f.buf = append(appendHex(f.buf, []byte{sc.Flags}), '"')
+	}
+}
+
+func appendHex(dst, src []byte) []byte {
+	for _, b := range src {
+		dst = append(dst, hex[b>>4], hex[b&0xf])
+	}
+	return dst
+}
+
+// decodeHex decodes the lower case hex s into dst, that has half of its size
+func decodeHex(dst []byte, s string) bool {
+	for i := range dst {
+		hi, ok1 := hexValue(s[2*i])
+		lo, ok2 := hexValue(s[2*i+1])
+		if !ok1 || !ok2 {
+			return false
+		}
+		dst[i] = hi<<4 | lo
+	}
+	return true
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
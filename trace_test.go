@@ -0,0 +1,86 @@
+package goplogjson
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(testTraceparent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.IsSampled() || sc.SpanID != [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7} {
+		t.Errorf("wrong span context %+v", sc)
+	}
+	if got := sc.Traceparent(); got != testTraceparent {
+		t.Errorf("want %s and got %s", testTraceparent, got)
+	}
+	for _, s := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceparent(s); err != ErrInvalidTraceparent {
+			t.Errorf("%q: want %v and got %v", s, ErrInvalidTraceparent, err)
+		}
+	}
+}
+
+func TestFieldCtxTrace(t *testing.T) {
+	sc, _ := ParseTraceparent(testTraceparent)
+	ctx := ContextWithSpanContext(context.Background(), sc)
+	tests := []struct {
+		format TraceFormat
+		want   string
+	}{
+		{W3CTraceFormat(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736", "span_id":"00f067aa0ba902b7", "trace_flags":"01"`},
+		{DatadogTraceFormat(), `"dd.trace_id":"11803532876627986230", "dd.span_id":"67667974448284343"`},
+		{GCPTraceFormat("my-project"), `"logging.googleapis.com/trace":"projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			"logging.googleapis.com/spanId":"00f067aa0ba902b7", "logging.googleapis.com/trace_sampled":true`},
+	}
+	for _, tt := range tests {
+		out := new(strings.Builder)
+		l := New(WithOutput(out), WithTraceFormat(tt.format))
+		l.Inf(Extend(l.NewFieldBuilder()).Ctx(ctx).Msg("test"))
+		want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z", ` + tt.want + `}`
+		if diff := compareJson(want, out.String()); diff != "" {
+			t.Errorf("%s: %s", tt.format.TraceIDFieldName, diff)
+		}
+	}
+}
+
+// fakeSpan is a stand-in for the span of a tracing library
+type fakeSpan struct {
+	traceparent string
+}
+
+type fakeSpanKey struct{}
+
+func TestSpanContextFromContext(t *testing.T) {
+	old := SpanContextFromContext
+	defer func() { SpanContextFromContext = old }()
+	SpanContextFromContext = func(ctx context.Context) (SpanContext, bool) {
+		span, ok := ctx.Value(fakeSpanKey{}).(fakeSpan)
+		if !ok {
+			return SpanContext{}, false
+		}
+		sc, err := ParseTraceparent(span.traceparent)
+		return sc, err == nil
+	}
+
+	out := new(strings.Builder)
+	l := New(WithOutput(out))
+	ctx := context.WithValue(context.Background(), fakeSpanKey{}, fakeSpan{testTraceparent})
+	l.Inf(Extend(l.NewFieldBuilder()).Ctx(ctx).Msg("test"))
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z",
+		"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736", "span_id":"00f067aa0ba902b7", "trace_flags":"01"}`
+	if diff := compareJson(want, out.String()); diff != "" {
+		t.Errorf(diff)
+	}
+}
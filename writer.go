@@ -0,0 +1,83 @@
+package goplogjson
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/axpira/gop/log"
+)
+
+var failedWrites uint64
+
+// FailedWrites returns the number of lines the outputs failed to write
+func FailedWrites() uint64 {
+	return atomic.LoadUint64(&failedWrites)
+}
+
+func countFailedWrite() {
+	atomic.AddUint64(&failedWrites, 1)
+}
+
+// LevelWriter is an io.Writer that also receives the level of each line.
+// The logger calls WriteLevel instead of Write when its output implements it
+type LevelWriter interface {
+	io.Writer
+	WriteLevel(log.Level, []byte) (int, error)
+}
+
+func writeLevel(out io.Writer, lv log.Level, p []byte) (int, error) {
+	if lw, ok := out.(LevelWriter); ok {
+		return lw.WriteLevel(lv, p)
+	}
+	return out.Write(p)
+}
+
+// WithLockedOutput is like WithOutput but serializes the writes,
+// see NewLockedWriter
+func WithLockedOutput(out io.Writer) log.LoggerOption {
+	return WithOutput(NewLockedWriter(out))
+}
+
+// NewLockedWriter returns a writer that holds a lock while writing
+// each line to out, so lines logged by concurrent goroutines are never
+// interleaved. Each line is written whole with a single write, even when
+// it's larger than PIPE_BUF (4096 bytes on Linux), so on a pipe shared
+// with other processes their writes may interleave with the longer lines.
+// Writers already safe for concurrent use, like *os.File and AsyncWriter,
+// are returned as they are
+func NewLockedWriter(out io.Writer) io.Writer {
+	switch out.(type) {
+	case *os.File, *lockedWriter, *AsyncWriter:
+		return out
+	}
+	return &lockedWriter{out: out}
+}
+
+type lockedWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(log.NoLevel, p)
+}
+
+func (w *lockedWriter) WriteLevel(lv log.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return writeLevel(w.out, lv, p)
+}
+
+func (w *lockedWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return syncWriter(w.out)
+}
+
+func (w *lockedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return closeWriter(w.out)
+}
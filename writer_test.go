@@ -0,0 +1,107 @@
+package goplogjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/axpira/gop/log"
+)
+
+// pipeBuf is PIPE_BUF on Linux, the lines of the tests are longer
+const pipeBuf = 4096
+
+func TestLockedWriterConcurrentLines(t *testing.T) {
+	out := new(bytes.Buffer)
+	l := New(WithLockedOutput(out))
+	long := strings.Repeat("a", 3*pipeBuf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := l.With(l.NewFieldBuilder().Int("goroutine", i))
+			for j := 0; j < 5; j++ {
+				child.Inf(child.NewFieldBuilder().Int("line", j).Str("long", long))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("want 1000 lines and got %d", len(lines))
+	}
+	for i, line := range lines {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid json on line %d: %s", i, err)
+		}
+		if m["long"] != long {
+			t.Fatalf("want long field on line %d", i)
+		}
+	}
+}
+
+// messageWriter records each write as a message, like a syslog or
+// journald socket
+type messageWriter struct {
+	msgs   []string
+	levels []log.Level
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(log.NoLevel, p)
+}
+
+func (w *messageWriter) WriteLevel(lv log.Level, p []byte) (int, error) {
+	w.msgs = append(w.msgs, string(p))
+	w.levels = append(w.levels, lv)
+	return len(p), nil
+}
+
+func TestLockedWriterSingleWrite(t *testing.T) {
+	out := &messageWriter{}
+	l := New(WithLockedOutput(out))
+	long := strings.Repeat("a", 2*pipeBuf)
+	l.Inf(l.NewFieldBuilder().Str("long", long))
+	if len(out.msgs) != 1 || out.levels[0] != log.InfoLevel {
+		t.Fatalf("want 1 write with info level and got %d %v", len(out.msgs), out.levels)
+	}
+	if !strings.Contains(out.msgs[0], long) || !strings.HasSuffix(out.msgs[0], "}\n") {
+		t.Errorf("want whole line and got %q", out.msgs[0])
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestLoggerWriteError(t *testing.T) {
+	fallback := new(strings.Builder)
+	var gotErr error
+	l := New(
+		WithOutput(failWriter{}),
+		WithFallback(fallback),
+		WithErrorHandler(func(err error) { gotErr = err }),
+	)
+	before := FailedWrites()
+	l.Info("test")
+
+	want := `{"level":"info", "msg":"test", "time":"2021-09-26T07:57:36Z"}`
+	if diff := compareJson(want, fallback.String()); diff != "" {
+		t.Errorf(diff)
+	}
+	if gotErr == nil || gotErr.Error() != "disk full" {
+		t.Errorf("want error handler called with disk full and got %v", gotErr)
+	}
+	if got := FailedWrites() - before; got != 1 {
+		t.Errorf("want 1 failed write and got %d", got)
+	}
+}